@@ -0,0 +1,124 @@
+package kafkaavro
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a size bounded least recently used cache with optional per-entry expiry.
+// Entries may hold an error instead of a value to support negative caching.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[interface{}]*list.Element
+}
+
+type cacheEntry struct {
+	key     interface{}
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+func (e *cacheEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// newLRUCache returns a cache holding at most size entries, a size of 0 or less means unbounded
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[interface{}]*list.Element),
+	}
+}
+
+// Get returns the cached value or error for the key and whether an unexpired entry was found
+func (c *lruCache) Get(key interface{}) (interface{}, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if entry.expired(time.Now()) {
+		c.removeElement(el)
+		return nil, nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, entry.err, true
+}
+
+// Add caches the value for the key, a ttl of 0 means the entry never expires
+func (c *lruCache) Add(key, value interface{}, ttl time.Duration) {
+	c.add(&cacheEntry{key: key, value: value}, ttl)
+}
+
+// AddError caches the error for the key, a ttl of 0 means the entry never expires
+func (c *lruCache) AddError(key interface{}, err error, ttl time.Duration) {
+	c.add(&cacheEntry{key: key, err: err}, ttl)
+}
+
+func (c *lruCache) add(entry *cacheEntry, ttl time.Duration) {
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[entry.key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[entry.key] = c.ll.PushFront(entry)
+	if c.size > 0 && c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove drops the entry for the key
+func (c *lruCache) Remove(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// RemoveFunc drops every entry whose key matches the predicate
+func (c *lruCache) RemoveFunc(match func(key interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		if match(key) {
+			c.removeElement(el)
+		}
+	}
+}
+
+// RemoveErrorsFunc drops every cached error whose key matches the predicate
+func (c *lruCache) RemoveErrorsFunc(match func(key interface{}) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		if el.Value.(*cacheEntry).err != nil && match(key) {
+			c.removeElement(el)
+		}
+	}
+}
+
+// Purge drops all entries
+func (c *lruCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[interface{}]*list.Element)
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).key)
+}
@@ -1,10 +1,18 @@
 package kafkaavro
 
 import (
-	"sync"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hamba/avro"
 	schemaregistry "github.com/landoop/schema-registry"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // Portions of the code are taken from https://github.com/dangkaka/go-kafka-avro
@@ -16,99 +24,426 @@ type SchemaRegistryClient interface {
 
 // CachedSchemaRegistryClient is a schema registry client that will cache some data to improve performance
 type CachedSchemaRegistryClient struct {
-	SchemaRegistryClient   *schemaregistry.Client
-	schemaCache            map[int]avro.Schema
-	schemaCacheLock        sync.RWMutex
-	registeredSubjects     map[string]int
-	registeredSubjectsLock sync.RWMutex
+	SchemaRegistryClient *schemaregistry.Client
+
+	baseURL       string
+	httpClient    *http.Client
+	clientOptions []schemaregistry.Option
+	cacheSize     int
+	latestTTL     time.Duration
+	notFoundTTL   time.Duration
+	cacheDir      string
+	metrics       Metrics
+	logger        Logger
+
+	tracerProvider trace.TracerProvider
+
+	schemaCache        *lruCache // map[int]avro.Schema
+	versionCache       *lruCache // map[subjectVersion]avro.Schema
+	latestCache        *lruCache // map[string]latestSchema
+	registeredSubjects *lruCache // map[registeredSchema]int
+
+	// fileCache persists schemas and registered ids when a cache directory is configured
+	fileCache *fileCache
+
+	// requests coalesces concurrent registry requests for the same key
+	requests singleflight.Group
+}
+
+type subjectVersion struct {
+	subject string
+	version int
+}
+
+type latestSchema struct {
+	id     int
+	schema avro.Schema
+}
+
+type registeredSchema struct {
+	subject     string
+	fingerprint [32]byte
 }
 
 func NewCachedSchemaRegistryClient(baseURL string, options ...schemaregistry.Option) (*CachedSchemaRegistryClient, error) {
-	srClient, err := schemaregistry.NewClient(baseURL, options...)
+	return NewCachedSchemaRegistryClientWithOptions(baseURL, WithRegistryClientOptions(options...))
+}
+
+// NewCachedSchemaRegistryClientWithOptions creates a cached schema registry client configured with registry options
+func NewCachedSchemaRegistryClientWithOptions(baseURL string, opts ...RegistryOption) (*CachedSchemaRegistryClient, error) {
+	cached := &CachedSchemaRegistryClient{
+		baseURL:    formatBaseURL(baseURL),
+		httpClient: &http.Client{},
+		metrics:    nopMetrics{},
+		logger:     NewStdLogger(),
+	}
+	for _, opt := range opts {
+		opt.applyR(cached)
+	}
+	if cached.tracerProvider != nil {
+		// every request goes through the tracing transport, including those of the underlying client,
+		// which wraps the transport of the client set with WithRegistryHTTPClient
+		httpClient := *cached.httpClient
+		httpClient.Transport = newTracingTransport(httpClient.Transport, cached.tracerProvider)
+		cached.httpClient = &httpClient
+		cached.clientOptions = append(cached.clientOptions, schemaregistry.UsingClient(&httpClient))
+	}
+
+	srClient, err := schemaregistry.NewClient(baseURL, cached.clientOptions...)
 	if err != nil {
 		return nil, err
 	}
-	return &CachedSchemaRegistryClient{
-		SchemaRegistryClient: srClient,
-		schemaCache:          make(map[int]avro.Schema),
-		registeredSubjects:   make(map[string]int),
-	}, nil
+	cached.SchemaRegistryClient = srClient
+	cached.schemaCache = newLRUCache(cached.cacheSize)
+	cached.versionCache = newLRUCache(cached.cacheSize)
+	cached.latestCache = newLRUCache(cached.cacheSize)
+	cached.registeredSubjects = newLRUCache(cached.cacheSize)
+	if cached.cacheDir != "" {
+		if cached.fileCache, err = newFileCache(cached.cacheDir); err != nil {
+			return nil, err
+		}
+	}
+	return cached, nil
 }
 
-// GetSchemaByID will return and cache the schema with the given id
+// GetSchemaByID will return and cache the schema with the given id.
+// Concurrent lookups of the same id share a single registry request.
+// With a cache directory configured the schema is served from disk when the registry is unreachable.
 func (cached *CachedSchemaRegistryClient) GetSchemaByID(id int) (avro.Schema, error) {
-	cached.schemaCacheLock.RLock()
-	cachedResult := cached.schemaCache[id]
-	cached.schemaCacheLock.RUnlock()
-	if nil != cachedResult {
-		return cachedResult, nil
-	}
-	schemaJSON, err := cached.SchemaRegistryClient.GetSchemaByID(id)
-	if err != nil {
-		return nil, err
+	return cached.GetSchemaByIDContext(context.Background(), id)
+}
+
+// GetSchemaByIDContext is GetSchemaByID with a context for the registry request, which is traced as a child
+// of the span of the context when tracing is enabled. The request shared by concurrent lookups is not cancelled
+// along with the context of the caller that started it, nor traced under the spans of the callers joining it.
+// A caller whose context is done stops waiting and gets the context error.
+func (cached *CachedSchemaRegistryClient) GetSchemaByIDContext(ctx context.Context, id int) (avro.Schema, error) {
+	if cachedResult, err, found := cached.schemaCache.Get(id); found {
+		cached.metrics.SchemaCacheHit(SchemaCacheID)
+		if err != nil {
+			return nil, err
+		}
+		return cachedResult.(avro.Schema), nil
 	}
-	schema, err := avro.Parse(schemaJSON)
-	if err != nil {
-		return nil, err
+	cached.metrics.SchemaCacheMiss(SchemaCacheID)
+	// the request outlives the caller that started it when other callers wait for it
+	fetchCtx := detachedContext{ctx}
+	results := cached.requests.DoChan(fmt.Sprintf("id:%d", id), func() (interface{}, error) {
+		start := time.Now()
+		registered, err := cached.getSchemaByID(fetchCtx, id)
+		cached.metrics.SchemaFetched(SchemaCacheID, time.Since(start), err)
+		if err != nil {
+			err = registryError(err, "", id)
+			cached.cacheNotFound(cached.schemaCache, id, err)
+			if !isUnavailable(err) || cached.fileCache == nil {
+				return nil, err
+			}
+			schemaJSON, referenced, fileErr := cached.fileCache.GetSchema(id)
+			if fileErr != nil {
+				return nil, err
+			}
+			cached.logger.Warn("schema registry unavailable, using schema from cache dir", "schema_id", id, "error", err)
+			schema, err := parseWithReferences(schemaJSON, referenced)
+			if err != nil {
+				return nil, err
+			}
+			cached.schemaCache.Add(id, schema, 0)
+			return schema, nil
+		}
+		cached.logger.Debug("schema fetched", "schema_id", id)
+		schema, referenced, err := cached.parseSchemaWithReferences(registered)
+		if err != nil {
+			return nil, err
+		}
+		if cached.fileCache != nil {
+			// referenced schemas are persisted along so the copy parses offline,
+			// the file cache is best effort and failing to persist must not fail the lookup
+			_ = cached.fileCache.PutSchema(id, registered.Schema, referenced)
+		}
+		cached.schemaCache.Add(id, schema, 0)
+		return schema, nil
+	})
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(avro.Schema), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	cached.schemaCacheLock.Lock()
-	cached.schemaCache[id] = schema
-	cached.schemaCacheLock.Unlock()
-	return schema, nil
 }
 
+// detachedContext carries the values of its parent, such as its span, without its deadline and cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
 // Subjects returns a list of subjects
 func (cached *CachedSchemaRegistryClient) Subjects() ([]string, error) {
-	return cached.SchemaRegistryClient.Subjects()
+	subjects, err := cached.SchemaRegistryClient.Subjects()
+	if err != nil {
+		return nil, registryError(err, "", 0)
+	}
+	return subjects, nil
 }
 
 // Versions returns a list of all versions of a subject
 func (cached *CachedSchemaRegistryClient) Versions(subject string) ([]int, error) {
-	return cached.SchemaRegistryClient.Versions(subject)
+	versions, err := cached.SchemaRegistryClient.Versions(subject)
+	if err != nil {
+		return nil, registryError(err, subject, 0)
+	}
+	return versions, nil
 }
 
-// GetSchemaBySubject returns the schema for a specific version of a subject
+// GetSchemaBySubject returns and caches the schema for a specific version of a subject
 func (cached *CachedSchemaRegistryClient) GetSchemaBySubject(subject string, version int) (avro.Schema, error) {
-	schema, err := cached.SchemaRegistryClient.GetSchemaBySubject(subject, version)
+	key := subjectVersion{subject: subject, version: version}
+	if cachedResult, err, found := cached.versionCache.Get(key); found {
+		cached.metrics.SchemaCacheHit(SchemaCacheVersion)
+		if err != nil {
+			return nil, err
+		}
+		return cachedResult.(avro.Schema), nil
+	}
+	cached.metrics.SchemaCacheMiss(SchemaCacheVersion)
+	parsed, err, _ := cached.requests.Do(fmt.Sprintf("version:%s:%d", subject, version), func() (interface{}, error) {
+		start := time.Now()
+		schema, err := cached.getSubjectVersion(subject, strconv.Itoa(version))
+		cached.metrics.SchemaFetched(SchemaCacheVersion, time.Since(start), err)
+		if err != nil {
+			err = registryError(err, subject, 0)
+			cached.cacheNotFound(cached.versionCache, key, err)
+			return nil, err
+		}
+		parsed, err := cached.parseSchema(schema)
+		if err != nil {
+			return nil, err
+		}
+		cached.versionCache.Add(key, parsed, 0)
+		return parsed, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return avro.Parse(schema.Schema)
+	return parsed.(avro.Schema), nil
 }
 
-// GetLatestSchema returns the highest version schema for a subject
+// GetLatestSchema returns the highest version schema for a subject.
+// Results are only cached when a latest schema TTL is configured.
 func (cached *CachedSchemaRegistryClient) GetLatestSchema(subject string) (avro.Schema, error) {
-	schema, err := cached.SchemaRegistryClient.GetLatestSchema(subject)
+	_, schema, err := cached.GetLatestSchemaWithID(subject)
+	return schema, err
+}
+
+// GetLatestSchemaWithID returns the latest schema registered for the subject along with its ID
+func (cached *CachedSchemaRegistryClient) GetLatestSchemaWithID(subject string) (int, avro.Schema, error) {
+	if cachedResult, err, found := cached.latestCache.Get(subject); found {
+		cached.metrics.SchemaCacheHit(SchemaCacheLatest)
+		if err != nil {
+			return 0, nil, err
+		}
+		latest := cachedResult.(latestSchema)
+		return latest.id, latest.schema, nil
+	}
+	cached.metrics.SchemaCacheMiss(SchemaCacheLatest)
+	result, err, _ := cached.requests.Do("latest:"+subject, func() (interface{}, error) {
+		start := time.Now()
+		schema, err := cached.getSubjectVersion(subject, "latest")
+		cached.metrics.SchemaFetched(SchemaCacheLatest, time.Since(start), err)
+		if err != nil {
+			err = registryError(err, subject, 0)
+			cached.cacheNotFound(cached.latestCache, subject, err)
+			return nil, err
+		}
+		parsed, err := cached.parseSchema(schema)
+		if err != nil {
+			return nil, err
+		}
+		latest := latestSchema{id: schema.ID, schema: parsed}
+		if cached.latestTTL > 0 {
+			cached.latestCache.Add(subject, latest, cached.latestTTL)
+		}
+		return latest, nil
+	})
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
-	return avro.Parse(schema.Schema)
+	latest := result.(latestSchema)
+	return latest.id, latest.schema, nil
 }
 
-// RegisterNewSchema will return and cache the id with the given schema
+// RegisterNewSchema will return and cache the id with the given schema.
+// IDs are cached per subject and canonical form fingerprint so every registered
+// version of a subject resolves to its own ID. With a cache directory configured
+// previously registered IDs are served from disk when the registry is unreachable.
 func (cached *CachedSchemaRegistryClient) RegisterNewSchema(subject string, schema avro.Schema) (int, error) {
-	cached.registeredSubjectsLock.RLock()
-	cachedResult, found := cached.registeredSubjects[subject]
-	cached.registeredSubjectsLock.RUnlock()
-	if found {
-		return cachedResult, nil
+	key := registeredSchema{subject: subject, fingerprint: schema.Fingerprint()}
+	return cached.register(key, func() (int, error) {
+		return cached.SchemaRegistryClient.RegisterNewSchema(subject, schema.String())
+	})
+}
+
+// register returns the cached id of the registered schema or registers it
+func (cached *CachedSchemaRegistryClient) register(key registeredSchema, registerFn func() (int, error)) (int, error) {
+	if cachedResult, _, found := cached.registeredSubjects.Get(key); found {
+		cached.metrics.SchemaCacheHit(SchemaCacheRegistered)
+		return cachedResult.(int), nil
 	}
-	id, err := cached.SchemaRegistryClient.RegisterNewSchema(subject, schema.String())
+	cached.metrics.SchemaCacheMiss(SchemaCacheRegistered)
+	id, err, _ := cached.requests.Do(fmt.Sprintf("register:%s:%x", key.subject, key.fingerprint), func() (interface{}, error) {
+		start := time.Now()
+		id, err := registerFn()
+		cached.metrics.SchemaFetched(SchemaCacheRegistered, time.Since(start), err)
+		if err != nil {
+			err = registryError(err, key.subject, 0)
+			if !isUnavailable(err) || cached.fileCache == nil {
+				return nil, err
+			}
+			var fileErr error
+			if id, fileErr = cached.fileCache.GetRegisteredID(key.subject, key.fingerprint); fileErr != nil {
+				return nil, err
+			}
+			cached.logger.Warn("schema registry unavailable, using registered schema id from cache dir", "subject", key.subject, "schema_id", id, "error", err)
+		} else {
+			cached.invalidateRegistered(key.subject)
+			if cached.fileCache != nil {
+				_ = cached.fileCache.PutRegisteredID(key.subject, key.fingerprint, id)
+			}
+		}
+		cached.registeredSubjects.Add(key, id, 0)
+		return id, nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	cached.registeredSubjectsLock.Lock()
-	cached.registeredSubjects[subject] = id
-	cached.registeredSubjectsLock.Unlock()
-	return id, nil
+	return id.(int), nil
+}
+
+// invalidateRegistered drops the latest schema and the cached not found versions of the subject
+// a schema was just registered to, registered versions never change and are kept
+func (cached *CachedSchemaRegistryClient) invalidateRegistered(subject string) {
+	cached.latestCache.Remove(subject)
+	cached.versionCache.RemoveErrorsFunc(func(key interface{}) bool {
+		return key.(subjectVersion).subject == subject
+	})
 }
 
 // IsSchemaRegistered checks if a specific schema is already registered to a subject
 func (cached *CachedSchemaRegistryClient) IsSchemaRegistered(subject string, schema avro.Schema) (bool, schemaregistry.Schema, error) {
-	return cached.SchemaRegistryClient.IsRegistered(subject, schema.String())
+	registered, registeredSchema, err := cached.SchemaRegistryClient.IsRegistered(subject, schema.String())
+	if err != nil {
+		return registered, registeredSchema, registryError(err, subject, 0)
+	}
+	return registered, registeredSchema, nil
 }
 
 // DeleteSubject deletes the subject, should only be used in development
 func (cached *CachedSchemaRegistryClient) DeleteSubject(subject string) (versions []int, err error) {
-	return cached.SchemaRegistryClient.DeleteSubject(subject)
+	versions, err = cached.SchemaRegistryClient.DeleteSubject(subject)
+	if err != nil {
+		return nil, registryError(err, subject, 0)
+	}
+	cached.InvalidateSubject(subject)
+	return versions, nil
+}
+
+// InvalidateSchemaID drops the cached schema with the given id
+func (cached *CachedSchemaRegistryClient) InvalidateSchemaID(id int) {
+	cached.schemaCache.Remove(id)
+}
+
+// InvalidateSubject drops every cached schema, version and registered id of the subject
+func (cached *CachedSchemaRegistryClient) InvalidateSubject(subject string) {
+	cached.latestCache.Remove(subject)
+	cached.versionCache.RemoveFunc(func(key interface{}) bool {
+		return key.(subjectVersion).subject == subject
+	})
+	cached.registeredSubjects.RemoveFunc(func(key interface{}) bool {
+		return key.(registeredSchema).subject == subject
+	})
+}
+
+// InvalidateAll drops everything cached by the client
+func (cached *CachedSchemaRegistryClient) InvalidateAll() {
+	cached.schemaCache.Purge()
+	cached.versionCache.Purge()
+	cached.latestCache.Purge()
+	cached.registeredSubjects.Purge()
+}
+
+// formatBaseURL strips the trailing slash and defaults to http when the scheme is missing
+func formatBaseURL(baseURL string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return baseURL
+}
+
+// cacheNotFound remembers not found responses when negative caching is enabled
+func (cached *CachedSchemaRegistryClient) cacheNotFound(cache *lruCache, key interface{}, err error) {
+	if cached.notFoundTTL <= 0 {
+		return
+	}
+	if isNotFound(err) {
+		cache.AddError(key, err, cached.notFoundTTL)
+	}
+}
+
+// registryError classifies a failed registry request as ErrSchemaNotFound, ErrSchemaIncompatible
+// or ErrRegistryUnavailable, other failures are returned as is
+func registryError(err error, subject string, id int) error {
+	switch {
+	case isNotFound(err):
+		return ErrSchemaNotFound{SchemaID: id, Subject: subject, Err: err}
+	case isIncompatible(err):
+		return ErrSchemaIncompatible{Subject: subject, Err: err}
+	case isUnavailable(err):
+		return ErrRegistryUnavailable{Err: err}
+	}
+	return err
+}
+
+// isUnavailable reports whether the registry could not be reached or failed with a server error
+func isUnavailable(err error) bool {
+	var resErr schemaregistry.ResourceError
+	if !errors.As(err, &resErr) {
+		return true
+	}
+	return httpStatus(resErr) >= http.StatusInternalServerError
+}
+
+// isNotFound reports whether the registry answered with a 404 or one of its 404xx error codes
+func isNotFound(err error) bool {
+	var resErr schemaregistry.ResourceError
+	if !errors.As(err, &resErr) {
+		return false
+	}
+	return httpStatus(resErr) == http.StatusNotFound
+}
+
+// isIncompatible reports whether the registry rejected a schema with a 409 conflict
+func isIncompatible(err error) bool {
+	var resErr schemaregistry.ResourceError
+	if !errors.As(err, &resErr) {
+		return false
+	}
+	return httpStatus(resErr) == http.StatusConflict
+}
+
+// httpStatus returns the HTTP status of a registry error, registry specific
+// error codes such as 40403 carry the status in their first three digits
+func httpStatus(resErr schemaregistry.ResourceError) int {
+	if resErr.ErrorCode >= 10000 {
+		return resErr.ErrorCode / 100
+	}
+	return resErr.ErrorCode
 }
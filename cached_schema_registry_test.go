@@ -1,15 +1,21 @@
 package kafkaavro_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hamba/avro"
 	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/registryserver"
 )
 
 // Portions of the code are taken from https://github.com/dangkaka/go-kafka-avro
@@ -201,6 +207,26 @@ func TestCachedSchemaRegistryClient_GetLatestSchema(t *testing.T) {
 	}
 }
 
+func TestCachedSchemaRegistryClient_GetLatestSchemaWithID(t *testing.T) {
+	testObject := createSchemaRegistryTestObject(t, "test", 7)
+	mockServer := testObject.MockServer
+	defer mockServer.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(mockServer.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	id, responseSchema, err := client.GetLatestSchemaWithID(testObject.Subject)
+	if nil != err {
+		t.Fatalf("Error getting latest schema: %v", err)
+	}
+	if id != 7 {
+		t.Errorf("Ids do not match. Expected: %d, got: %d", 7, id)
+	}
+	if responseSchema.String() != testObject.Schema.String() {
+		t.Errorf("Schemas do not match. Expected: %s, got: %s", testObject.Schema.String(), responseSchema.String())
+	}
+}
+
 func TestCachedSchemaRegistryClient_CreateSubject(t *testing.T) {
 	testObject := createSchemaRegistryTestObject(t, "test", 1)
 	mockServer := testObject.MockServer
@@ -250,6 +276,55 @@ func TestCachedSchemaRegistryClient_CreateSubject(t *testing.T) {
 	}
 }
 
+func TestCachedSchemaRegistryClient_RegisterEvolvedSchema(t *testing.T) {
+	count := 0
+	ids := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		var body struct {
+			Schema string `json:"schema"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := ids[body.Schema]; !ok {
+			ids[body.Schema] = len(ids) + 1
+		}
+		str, _ := json.Marshal(idResponse{ids[body.Schema]})
+		fmt.Fprintf(w, string(str))
+	}))
+	defer server.Close()
+
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	v1 := avro.MustParse(`{"type": "record", "name": "evolved", "fields" : [{"name": "val", "type": "int", "default": 0}]}`)
+	v2 := avro.MustParse(`{"type": "record", "name": "evolved", "fields" : [{"name": "val", "type": "int", "default": 0}, {"name": "other", "type": "string", "default": ""}]}`)
+
+	id1, err := client.RegisterNewSchema("evolved", v1)
+	if nil != err {
+		t.Errorf("Error registering schema: %s", err.Error())
+	}
+	id2, err := client.RegisterNewSchema("evolved", v2)
+	if nil != err {
+		t.Errorf("Error registering schema: %s", err.Error())
+	}
+	if id1 == id2 {
+		t.Errorf("Expected different ids for different schemas, got %d", id1)
+	}
+	for schema, id := range map[avro.Schema]int{v1: id1, v2: id2} {
+		cachedID, err := client.RegisterNewSchema("evolved", schema)
+		if nil != err {
+			t.Errorf("Error registering schema: %s", err.Error())
+		}
+		if cachedID != id {
+			t.Errorf("Ids do not match. Expected: %d, got: %d", id, cachedID)
+		}
+	}
+	if count != 2 {
+		t.Errorf("Expected call count of 2, got %d", count)
+	}
+}
+
 func TestCachedSchemaRegistryClient_IsSchemaRegistered(t *testing.T) {
 	testObject := createSchemaRegistryTestObject(t, "test", 1)
 	mockServer := testObject.MockServer
@@ -284,6 +359,433 @@ func TestCachedSchemaRegistryClient_DeleteSubject(t *testing.T) {
 	}
 }
 
+func createSchemaByIDServer(schemas map[int]string) (*httptest.Server, *int) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		var id int
+		if _, err := fmt.Sscanf(r.URL.Path, schemaByID, &id); err == nil {
+			if schema, ok := schemas[id]; ok {
+				str, _ := json.Marshal(map[string]string{"schema": schema})
+				fmt.Fprintf(w, string(str))
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error_code": 40403, "message": "Schema not found"}`)
+	}))
+	return server, &count
+}
+
+func TestCachedSchemaRegistryClient_SchemaCacheSize(t *testing.T) {
+	server, count := createSchemaByIDServer(map[int]string{1: `"string"`, 2: `"int"`})
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL, kafkaavro.WithSchemaCacheSize(1))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	for _, id := range []int{1, 1, 2, 2, 1} {
+		if _, err = client.GetSchemaByID(id); nil != err {
+			t.Errorf("Error getting schema: %s", err.Error())
+		}
+	}
+	if *count != 3 {
+		t.Errorf("Expected call count of 3, got %d", *count)
+	}
+}
+
+func TestCachedSchemaRegistryClient_NotFoundCacheTTL(t *testing.T) {
+	server, count := createSchemaByIDServer(map[int]string{})
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL, kafkaavro.WithNotFoundCacheTTL(50*time.Millisecond))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = client.GetSchemaByID(1); nil == err {
+			t.Error("Expected not found error")
+		}
+	}
+	if *count != 1 {
+		t.Errorf("Expected call count of 1, got %d", *count)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err = client.GetSchemaByID(1); nil == err {
+		t.Error("Expected not found error")
+	}
+	if *count != 2 {
+		t.Errorf("Expected call count of 2, got %d", *count)
+	}
+}
+
+func TestCachedSchemaRegistryClient_LatestSchemaCacheTTL(t *testing.T) {
+	testObject := createSchemaRegistryTestObject(t, "test", 1)
+	mockServer := testObject.MockServer
+	defer mockServer.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(mockServer.URL, kafkaavro.WithLatestSchemaCacheTTL(time.Minute))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = client.GetLatestSchema(testObject.Subject); nil != err {
+			t.Errorf("Error getting latest schema: %v", err)
+		}
+	}
+	if testObject.Count != 1 {
+		t.Errorf("Expected call count of 1, got %d", testObject.Count)
+	}
+	client.InvalidateSubject(testObject.Subject)
+	if _, err = client.GetLatestSchema(testObject.Subject); nil != err {
+		t.Errorf("Error getting latest schema: %v", err)
+	}
+	if testObject.Count != 2 {
+		t.Errorf("Expected call count of 2, got %d", testObject.Count)
+	}
+}
+
+func TestCachedSchemaRegistryClient_RegisterInvalidatesSubject(t *testing.T) {
+	server := httptest.NewServer(registryserver.New())
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL,
+		kafkaavro.WithLatestSchemaCacheTTL(time.Minute),
+		kafkaavro.WithNotFoundCacheTTL(time.Minute),
+	)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	if _, err = client.GetLatestSchema("test"); !kafkaavro.IsErrSchemaNotFound(err) {
+		t.Fatalf("Expected schema not found error, got %v", err)
+	}
+	if _, err = client.GetSchemaBySubject("test", 1); !kafkaavro.IsErrSchemaNotFound(err) {
+		t.Fatalf("Expected schema not found error, got %v", err)
+	}
+
+	v1 := avro.MustParse(`{"type": "record", "name": "test", "fields": [{"name": "name", "type": "string"}, {"name": "age", "type": "int"}]}`)
+	v2 := avro.MustParse(`{"type": "record", "name": "test", "fields": [{"name": "name", "type": "string"}]}`)
+	for _, schema := range []avro.Schema{v1, v2} {
+		id, err := client.RegisterNewSchema("test", schema)
+		if nil != err {
+			t.Fatalf("Error registering schema: %s", err.Error())
+		}
+		latestID, latest, err := client.GetLatestSchemaWithID("test")
+		if nil != err {
+			t.Fatalf("Error getting latest schema: %v", err)
+		}
+		if latestID != id || latest.String() != schema.String() {
+			t.Errorf("Latest schema is stale. Expected: %d %s, got: %d %s", id, schema.String(), latestID, latest.String())
+		}
+	}
+	if _, err = client.GetSchemaBySubject("test", 1); nil != err {
+		t.Errorf("Error getting schema by subject: %v", err)
+	}
+}
+
+func TestCachedSchemaRegistryClient_ConcurrentGetSchemaByID(t *testing.T) {
+	var count int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		<-release
+		fmt.Fprintf(w, `{"schema": "\"string\""}`)
+	}))
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetSchemaByID(1); nil != err {
+				t.Errorf("Error getting schema: %s", err.Error())
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if count != 1 {
+		t.Errorf("Expected call count of 1, got %d", count)
+	}
+}
+
+func TestCachedSchemaRegistryClient_ConcurrentGetSchemaByIDCancelled(t *testing.T) {
+	var count int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		<-release
+		fmt.Fprintf(w, `{"schema": "\"string\""}`)
+	}))
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+
+	// the caller starting the request gives up while another one waits for it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, err := client.GetSchemaByIDContext(ctx, 1)
+		cancelled <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	waiting := make(chan error)
+	go func() {
+		_, err := client.GetSchemaByIDContext(context.Background(), 1)
+		waiting <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to get the context error, got %v", err)
+	}
+	close(release)
+	if err := <-waiting; nil != err {
+		t.Errorf("Error getting schema: %s", err.Error())
+	}
+	if count != 1 {
+		t.Errorf("Expected call count of 1, got %d", count)
+	}
+}
+
+func TestCachedSchemaRegistryClient_SchemaCacheDir(t *testing.T) {
+	testObject := createSchemaRegistryTestObject(t, "test", 1)
+	mockServer := testObject.MockServer
+	dir := t.TempDir()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(mockServer.URL, kafkaavro.WithSchemaCacheDir(dir))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	if _, err = client.GetSchemaByID(testObject.ID); nil != err {
+		t.Fatalf("Error getting schema: %s", err.Error())
+	}
+	if _, err = client.RegisterNewSchema(testObject.Subject, testObject.Schema); nil != err {
+		t.Fatalf("Error registering schema: %s", err.Error())
+	}
+	mockServer.Close()
+
+	offline, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(mockServer.URL, kafkaavro.WithSchemaCacheDir(dir))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	responseSchema, err := offline.GetSchemaByID(testObject.ID)
+	if nil != err {
+		t.Fatalf("Error getting schema: %s", err.Error())
+	}
+	if responseSchema.String() != testObject.Schema.String() {
+		t.Errorf("Schemas do not match. Expected: %s, got: %s", testObject.Schema.String(), responseSchema.String())
+	}
+	id, err := offline.RegisterNewSchema(testObject.Subject, testObject.Schema)
+	if nil != err {
+		t.Fatalf("Error registering schema: %s", err.Error())
+	}
+	if id != testObject.ID {
+		t.Errorf("Ids do not match. Expected: %d, got: %d", testObject.ID, id)
+	}
+	if _, err = offline.GetSchemaByID(testObject.ID + 1); nil == err {
+		t.Error("Expected error for schema missing from the cache directory")
+	}
+}
+
+func TestCachedSchemaRegistryClient_SchemaReferences(t *testing.T) {
+	money := `{"type": "record", "name": "Money", "namespace": "com.example.refs", "fields": [{"name": "amount", "type": "long"}, {"name": "currency", "type": "string"}]}`
+	order := `{"type": "record", "name": "Order", "namespace": "com.example.refs", "fields": [{"name": "total", "type": "com.example.refs.Money"}]}`
+	references := []kafkaavro.SchemaReference{{Name: "com.example.refs.Money", Subject: "money-value", Version: 1}}
+
+	var registered map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == fmt.Sprintf(subjectVersions, "order-value"):
+			_ = json.NewDecoder(r.Body).Decode(&registered)
+			fmt.Fprintf(w, `{"id": 2}`)
+		case r.Method == "GET" && r.URL.Path == fmt.Sprintf(schemaByID, 2):
+			str, _ := json.Marshal(map[string]interface{}{"schema": order, "references": references})
+			fmt.Fprintf(w, string(str))
+		case r.Method == "GET" && r.URL.Path == fmt.Sprintf(subjectByVersion, "money-value", "1"):
+			str, _ := json.Marshal(schemaVersionResponse{"money-value", 1, money, 1})
+			fmt.Fprintf(w, string(str))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+
+	id, err := client.RegisterNewSchemaWithReferences("order-value", order, references)
+	if nil != err {
+		t.Fatalf("Error registering schema: %s", err.Error())
+	}
+	if id != 2 {
+		t.Errorf("Ids do not match. Expected: %d, got: %d", 2, id)
+	}
+	if registered["schema"] != order {
+		t.Errorf("Expected schema to be registered as is, got %v", registered["schema"])
+	}
+	if refs, ok := registered["references"].([]interface{}); !ok || len(refs) != 1 {
+		t.Errorf("Expected one reference to be registered, got %v", registered["references"])
+	}
+
+	schema, err := client.GetSchemaByID(2)
+	if nil != err {
+		t.Fatalf("Error getting schema: %s", err.Error())
+	}
+	data, err := avro.Marshal(schema, map[string]interface{}{
+		"total": map[string]interface{}{"amount": int64(100), "currency": "EUR"},
+	})
+	if nil != err {
+		t.Fatalf("Error encoding with referenced schema: %s", err.Error())
+	}
+	if len(data) == 0 {
+		t.Error("Expected encoded data")
+	}
+}
+
+// countingTransport counts the requests sent through the transport it wraps
+type countingTransport struct {
+	http.RoundTripper
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestCachedSchemaRegistryClient_RegistryHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(registryserver.New())
+	defer server.Close()
+	// the client of the TLS server trusts its certificate, requests sent with another client fail
+	httpClient := server.Client()
+	transport := &countingTransport{RoundTripper: httpClient.Transport}
+	httpClient.Transport = transport
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL, kafkaavro.WithRegistryHTTPClient(httpClient))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+
+	schema := avro.MustParse(`{"type": "record", "name": "test", "fields": [{"name": "name", "type": "string"}]}`)
+	id, err := client.RegisterNewSchema("test", schema)
+	if nil != err {
+		t.Fatalf("Error registering schema: %s", err.Error())
+	}
+	if _, err = client.GetSchemaByID(id); nil != err {
+		t.Errorf("Error getting schema by id: %v", err)
+	}
+	if _, err = client.GetSchemaBySubject("test", 1); nil != err {
+		t.Errorf("Error getting schema by subject: %v", err)
+	}
+	if _, err = client.GetLatestSchema("test"); nil != err {
+		t.Errorf("Error getting latest schema: %v", err)
+	}
+	if err = client.Ping(context.Background()); nil != err {
+		t.Errorf("Error pinging registry: %v", err)
+	}
+	if count := atomic.LoadInt32(&transport.count); count != 5 {
+		t.Errorf("Expected every request to go through the transport, got %d requests", count)
+	}
+}
+
+func TestCachedSchemaRegistryClient_SchemaReferencesCacheDir(t *testing.T) {
+	money := `{"type": "record", "name": "Money", "namespace": "com.example.refs", "fields": [{"name": "amount", "type": "long"}]}`
+	order := `{"type": "record", "name": "Order", "namespace": "com.example.refs", "fields": [{"name": "total", "type": "com.example.refs.Money"}]}`
+	references := []kafkaavro.SchemaReference{{Name: "com.example.refs.Money", Subject: "money-value", Version: 1}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf(schemaByID, 2):
+			str, _ := json.Marshal(map[string]interface{}{"schema": order, "references": references})
+			fmt.Fprint(w, string(str))
+		case fmt.Sprintf(subjectByVersion, "money-value", "1"):
+			str, _ := json.Marshal(schemaVersionResponse{"money-value", 1, money, 1})
+			fmt.Fprint(w, string(str))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	dir := t.TempDir()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL, kafkaavro.WithSchemaCacheDir(dir))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	schema, err := client.GetSchemaByID(2)
+	if nil != err {
+		t.Fatalf("Error getting schema: %s", err.Error())
+	}
+	server.Close()
+
+	offline, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL, kafkaavro.WithSchemaCacheDir(dir))
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+	responseSchema, err := offline.GetSchemaByID(2)
+	if nil != err {
+		t.Fatalf("Error getting schema: %s", err.Error())
+	}
+	if responseSchema.Fingerprint() != schema.Fingerprint() {
+		t.Errorf("Schemas do not match. Expected: %s, got: %s", schema.String(), responseSchema.String())
+	}
+}
+
+func TestCachedSchemaRegistryClient_RegisterNewSchemaOfType(t *testing.T) {
+	var registered map[string]interface{}
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		switch {
+		case r.Method == "POST" && r.URL.Path == fmt.Sprintf(subjectVersions, "proto-value"):
+			_ = json.NewDecoder(r.Body).Decode(&registered)
+			fmt.Fprintf(w, `{"id": 3}`)
+		case r.Method == "POST" && r.URL.Path == fmt.Sprintf(deleteSubject, "proto-value"):
+			fmt.Fprintf(w, `{"subject": "proto-value", "version": 1, "id": 3}`)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error_code": 40401, "message": "Subject not found"}`)
+		}
+	}))
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+
+	for i := 0; i < 2; i++ {
+		id, err := client.RegisterNewSchemaOfType("proto-value", kafkaavro.SchemaTypeProtobuf, timestampProto, nil)
+		if nil != err {
+			t.Fatalf("Error registering schema: %s", err.Error())
+		}
+		if id != 3 {
+			t.Errorf("Ids do not match. Expected: %d, got: %d", 3, id)
+		}
+	}
+	if count != 1 {
+		t.Errorf("Expected call count of 1, got %d", count)
+	}
+	if registered["schemaType"] != kafkaavro.SchemaTypeProtobuf {
+		t.Errorf("Expected schema type %s, got %v", kafkaavro.SchemaTypeProtobuf, registered["schemaType"])
+	}
+
+	id, err := client.LookupSchemaOfType("proto-value", kafkaavro.SchemaTypeProtobuf, timestampProto, nil)
+	if nil != err {
+		t.Fatalf("Error looking up schema: %s", err.Error())
+	}
+	if id != 3 {
+		t.Errorf("Ids do not match. Expected: %d, got: %d", 3, id)
+	}
+	if _, err = client.LookupSchemaOfType("other-value", kafkaavro.SchemaTypeProtobuf, timestampProto, nil); !kafkaavro.IsErrSchemaNotRegistered(err) {
+		t.Errorf("Expected schema not registered error, got %v", err)
+	}
+}
+
 func containsStr(array []string, value string) bool {
 	for _, v := range array {
 		if v == value {
@@ -301,3 +803,42 @@ func containsInt(array []int, value int) bool {
 	}
 	return false
 }
+
+func TestCachedSchemaRegistryClient_ErrorTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/schemas/ids/1"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code": 40403, "message": "Schema not found"}`)
+		case strings.HasPrefix(r.URL.Path, "/schemas/ids/2"):
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error_code": 50001, "message": "Error in the backend data store"}`)
+		default:
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"error_code": 409, "message": "Schema being registered is incompatible with an earlier schema"}`)
+		}
+	}))
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	if nil != err {
+		t.Fatalf("Error creating cached schema registry client: %s", err.Error())
+	}
+
+	_, err = client.GetSchemaByID(1)
+	var notFound kafkaavro.ErrSchemaNotFound
+	if !errors.As(err, &notFound) || notFound.SchemaID != 1 {
+		t.Errorf("Expected schema not found error for id 1, got %v", err)
+	}
+	if _, err = client.GetSchemaByID(2); !kafkaavro.IsErrRegistryUnavailable(err) {
+		t.Errorf("Expected registry unavailable error, got %v", err)
+	}
+	if _, err = client.RegisterNewSchema("test-value", avro.MustParse(`"int"`)); !kafkaavro.IsErrSchemaIncompatible(err) {
+		t.Errorf("Expected schema incompatible error, got %v", err)
+	}
+
+	server.Close()
+	if _, err = client.GetSchemaByID(3); !kafkaavro.IsErrRegistryUnavailable(err) {
+		t.Errorf("Expected registry unavailable error, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+// Command schema-registry runs a local schema registry compatible with the Confluent
+// schema registry API, for development and integration tests.
+//
+//	schema-registry -addr :8081 -file schemas.json
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/mycujoo/go-kafka-avro/v2/registryserver"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "address to listen on")
+	file := flag.String("file", "", "file persisting the schemas, schemas are kept in memory when empty")
+	flag.Parse()
+
+	server := registryserver.New()
+	if *file != "" {
+		var err error
+		if server, err = registryserver.NewWithFile(*file); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Printf("schema registry listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
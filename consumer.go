@@ -1,15 +1,20 @@
 package kafkaavro
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
-	"log"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/hamba/avro"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type KafkaConsumer interface {
@@ -22,23 +27,68 @@ type KafkaConsumer interface {
 
 type Consumer struct {
 	KafkaConsumer
-	valueFactory ValueFactory
-	eventHandler EventHandler
-	ensureTopics bool
-	avroAPI      avro.API
-	kafkaCfg     *kafka.ConfigMap
-	srURL        *url.URL
-	srClient     SchemaRegistryClient
+	valueFactory  ValueFactory
+	eventHandler  EventHandler
+	eventHandlers EventHandlers
+	statsHandler  StatsHandler
+	ensureTopics  bool
+	avroAPI       avro.API
+	kafkaCfg      *kafka.ConfigMap
+	srURL         *url.URL
+	srClient      SchemaRegistryClient
+	deserializer  Deserializer
+	wireFormat    WireFormat
+
+	// newDeserializer creates the deserializer set by an option once every option is applied
+	newDeserializer func(c *Consumer) Deserializer
+
+	decodeErrorPolicy DecodeErrorPolicy
+	metrics           Metrics
+	logger            Logger
+
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+	propagator     propagation.TextMapPropagator
+
+	// fatalMu guards fatalErr, the fatal error reported by kafka
+	fatalMu  sync.Mutex
+	fatalErr error
+
+	// pollMu guards lastPoll, the time of the last poll which did not report an error
+	pollMu   sync.Mutex
+	lastPoll time.Time
+	// maxPollInterval is the max.poll.interval.ms of the kafka config, the longest time between polls
+	maxPollInterval time.Duration
+
+	// spanMu guards span, the consumer span of the last fetched message
+	spanMu sync.Mutex
+	span   trace.Span
 
 	autoCommits bool
+	// readOnly consumers never commit offsets, they are used to replay messages
+	readOnly bool
 }
 
+// defaultMaxPollInterval is the default max.poll.interval.ms of librdkafka
+const defaultMaxPollInterval = 300 * time.Second
+
 type ValueFactory func(topic string) interface{}
 type EventHandler func(event kafka.Event)
 
 type Message struct {
 	*kafka.Message
 	Value interface{}
+
+	ctx context.Context
+}
+
+// Context returns the context of the message, which carries its consumer span when tracing is enabled.
+// Work done handling the message can be traced as children of that span.
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
 }
 
 // NewConsumer is a basic consumer to interact with schema registry, avro and kafka
@@ -47,6 +97,8 @@ func NewConsumer(topics []string, valueFactory ValueFactory, opts ...ConsumerOpt
 		valueFactory: valueFactory,
 		avroAPI:      avro.DefaultConfig,
 		ensureTopics: true,
+		metrics:      nopMetrics{},
+		logger:       NewStdLogger(),
 	}
 	// Loop through each option
 	for _, opt := range opts {
@@ -91,7 +143,11 @@ func NewConsumer(topics []string, valueFactory ValueFactory, opts ...ConsumerOpt
 			}
 		}
 
-		if c.KafkaConsumer, err = kafka.NewConsumer(c.kafkaCfg); err != nil {
+		kafkaCfg := c.kafkaCfg
+		if c.readOnly {
+			kafkaCfg = readOnlyKafkaConfig(c.kafkaCfg)
+		}
+		if c.KafkaConsumer, err = kafka.NewConsumer(kafkaCfg); err != nil {
 			return nil, errors.WithMessage(err, "cannot initialize kafka consumer")
 		}
 	}
@@ -107,14 +163,36 @@ func NewConsumer(topics []string, valueFactory ValueFactory, opts ...ConsumerOpt
 			c.srURL = envCfg.SchemaRegistry
 		}
 
-		if c.srClient, err = NewCachedSchemaRegistryClient(c.srURL.String()); err != nil {
+		registryOpts := []RegistryOption{WithRegistryMetrics(c.metrics), WithRegistryLogger(c.logger)}
+		if c.tracerProvider != nil {
+			registryOpts = append(registryOpts, WithRegistryTracerProvider(c.tracerProvider))
+		}
+		if c.srClient, err = NewCachedSchemaRegistryClientWithOptions(c.srURL.String(), registryOpts...); err != nil {
 			return nil, errors.WithMessage(err, "cannot initialize schema registry client")
 		}
 	}
 
+	if c.newDeserializer != nil {
+		c.deserializer = c.newDeserializer(c)
+	}
+	if c.deserializer == nil {
+		c.deserializer = &AvroDeserializer{API: c.avroAPI, Client: c.srClient, WireFormat: c.wireFormat}
+	}
+
+	if c.decodeErrorPolicy == nil {
+		c.decodeErrorPolicy = FailOnDecodeError()
+	}
+
+	if c.tracerProvider != nil {
+		c.tracer = c.tracerProvider.Tracer(tracerName)
+		if c.propagator == nil {
+			c.propagator = defaultPropagator()
+		}
+	}
+
 	if c.eventHandler == nil {
 		c.eventHandler = func(event kafka.Event) {
-			log.Println(event)
+			logEvent(c.logger, event)
 		}
 	}
 
@@ -130,10 +208,21 @@ func NewConsumer(topics []string, valueFactory ValueFactory, opts ...ConsumerOpt
 		}
 	}
 
-	if cfgVal, err := c.kafkaCfg.Get("enable.auto.commit", false); err == nil {
-		switch vType := cfgVal.(type) {
-		case bool:
-			c.autoCommits = vType
+	c.maxPollInterval = defaultMaxPollInterval
+	if c.kafkaCfg != nil {
+		if cfgVal, err := c.kafkaCfg.Get("enable.auto.commit", false); err == nil {
+			switch vType := cfgVal.(type) {
+			case bool:
+				c.autoCommits = vType
+			}
+		}
+		if cfgVal, err := c.kafkaCfg.Get("max.poll.interval.ms", 0); err == nil {
+			switch vType := cfgVal.(type) {
+			case int:
+				if vType > 0 {
+					c.maxPollInterval = time.Duration(vType) * time.Millisecond
+				}
+			}
 		}
 	}
 
@@ -141,7 +230,15 @@ func NewConsumer(topics []string, valueFactory ValueFactory, opts ...ConsumerOpt
 }
 
 func (ac *Consumer) fetchMessage(timeoutMs int) (*kafka.Message, error) {
+	if err := ac.fatalError(); err != nil {
+		return nil, err
+	}
 	ev := ac.KafkaConsumer.Poll(timeoutMs)
+	if _, isErr := ev.(kafka.Error); !isErr {
+		ac.pollMu.Lock()
+		ac.lastPoll = time.Now()
+		ac.pollMu.Unlock()
+	}
 	if ev == nil {
 		return nil, nil
 	}
@@ -149,12 +246,15 @@ func (ac *Consumer) fetchMessage(timeoutMs int) (*kafka.Message, error) {
 	case *kafka.Message:
 		return e, nil
 	default:
-		ac.eventHandler(e)
-		return nil, nil
+		return nil, ac.dispatchEvent(e)
 	}
 }
 
+// FetchMessage polls a message and decodes its value. When tracing is enabled the message is
+// decoded and handled in a consumer span continuing the trace propagated in its headers,
+// the span ends when the next message is fetched or the consumer is closed.
 func (ac *Consumer) FetchMessage(timeoutMs int) (*Message, error) {
+	ac.endSpan(nil)
 	msg, err := ac.fetchMessage(timeoutMs)
 	if err != nil {
 		return nil, err
@@ -162,17 +262,88 @@ func (ac *Consumer) FetchMessage(timeoutMs int) (*Message, error) {
 	if msg == nil {
 		return nil, nil
 	}
+	return ac.decodeMessage(msg)
+}
 
-	value := ac.valueFactory(*msg.TopicPartition.Topic)
+// decodeMessage decodes the value of the polled message, in a consumer span when tracing is enabled
+func (ac *Consumer) decodeMessage(msg *kafka.Message) (*Message, error) {
+	var err error
+	topic := *msg.TopicPartition.Topic
+	ac.metrics.MessageConsumed(topic)
+	ctx := ac.startSpan(msg)
+
+	value := ac.valueFactory(topic)
 	if value == nil {
-		return nil, ErrInvalidValue{Topic: *msg.TopicPartition.Topic}
+		err = ErrInvalidValue{Topic: topic}
+		ac.endSpan(err)
+		return nil, err
 	}
 
-	err = ac.decodeAvroBinary(msg.Value, &value)
-	return &Message{
+	decoded := &Message{
 		Message: msg,
 		Value:   value,
-	}, err
+		ctx:     ctx,
+	}
+	start := time.Now()
+	err = ac.decode(ctx, msg, &decoded.Value)
+	ac.metrics.Decoded(topic, time.Since(start), err)
+	if err != nil {
+		return ac.handleDecodeError(decoded, err)
+	}
+	return decoded, nil
+}
+
+// startSpan starts the consumer span of the message and returns its context
+func (ac *Consumer) startSpan(msg *kafka.Message) context.Context {
+	if ac.tracer == nil {
+		return context.Background()
+	}
+	topic := *msg.TopicPartition.Topic
+	ctx := ac.propagator.Extract(context.Background(), headerCarrier{&msg.Headers})
+	ctx, span := ac.tracer.Start(ctx, topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(topic)...),
+		trace.WithAttributes(
+			semconv.MessagingOperationProcess,
+			semconv.MessagingKafkaPartitionKey.Int64(int64(msg.TopicPartition.Partition)),
+		),
+	)
+	ac.spanMu.Lock()
+	ac.span = span
+	ac.spanMu.Unlock()
+	return ctx
+}
+
+// endSpan ends the consumer span of the last fetched message, if any, recording the error
+func (ac *Consumer) endSpan(err error) {
+	ac.spanMu.Lock()
+	span := ac.span
+	ac.span = nil
+	ac.spanMu.Unlock()
+	if span != nil {
+		endSpan(span, err)
+	}
+}
+
+// handleDecodeError applies the decode error policy, skipped messages are reported as a nil message
+// like any other poll that yields no message. They are only committed when the policy asks for it,
+// otherwise their offset is committed along with the next message committed on their partition.
+func (ac *Consumer) handleDecodeError(msg *Message, decodeErr error) (*Message, error) {
+	span := trace.SpanFromContext(msg.Context())
+	span.RecordError(decodeErr)
+	err := ac.decodeErrorPolicy(msg, decodeErr)
+	if err != nil && err != errSkipAndCommit {
+		span.SetStatus(codes.Error, err.Error())
+		return msg, err
+	}
+	ac.logger.Debug("skipping message that cannot be decoded", decodeErrorFields(msg.Message, decodeErr)...)
+	if err == nil || ac.readOnly {
+		return nil, nil
+	}
+	if _, err = ac.CommitMessage(msg.Message); err != nil {
+		return nil, ErrFailedCommit{Err: err}
+	}
+	return nil, nil
 }
 
 func (ac *Consumer) ReadMessage(timeoutMs int) (*Message, error) {
@@ -181,24 +352,79 @@ func (ac *Consumer) ReadMessage(timeoutMs int) (*Message, error) {
 		return nil, err
 	}
 	if ac.autoCommits && msg != nil { // FetchMessage may return a nil msg
-		if _, err = ac.KafkaConsumer.CommitMessage(msg.Message); err != nil {
+		if _, err = ac.CommitMessage(msg.Message); err != nil {
 			err = ErrFailedCommit{Err: err}
 		}
 	}
 	return msg, err
 }
 
-func (ac *Consumer) decodeAvroBinary(data []byte, v interface{}) error {
-	if data[0] != 0 {
-		return errors.New("invalid magic byte")
+// Close ends the consumer span of the last fetched message and closes the kafka consumer
+func (ac *Consumer) Close() error {
+	ac.endSpan(nil)
+	return ac.KafkaConsumer.Close()
+}
+
+// CommitMessage commits the offset of the message, failures are reported to the metrics
+func (ac *Consumer) CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error) {
+	offsets, err := ac.KafkaConsumer.CommitMessage(m)
+	if err != nil && m.TopicPartition.Topic != nil {
+		ac.metrics.CommitFailed(*m.TopicPartition.Topic)
+		ac.logger.Error("commit failed", append(messageFields(m.TopicPartition), "error", err)...)
+	}
+	return offsets, err
+}
+
+// decodeErrorFields returns the log fields of a decode failure, with the schema ID when known
+func decodeErrorFields(msg *kafka.Message, err error) []interface{} {
+	fields := messageFields(msg.TopicPartition)
+	var decodeErr ErrDecode
+	if errors.As(err, &decodeErr) && decodeErr.SchemaID != 0 {
+		fields = append(fields, "schema_id", decodeErr.SchemaID)
+	}
+	return append(fields, "error", err)
+}
+
+// decode deserializes the message value, moving the schema ID out of the headers when it is carried there.
+// Failures are reported as ErrDecode carrying the position of the message.
+func (ac *Consumer) decode(ctx context.Context, msg *kafka.Message, v interface{}) error {
+	data := msg.Value
+	if ac.wireFormat == WireFormatAuto || ac.wireFormat == WireFormatApicurioHeaders {
+		var found bool
+		var err error
+		if data, found, err = moveSchemaIDFromHeader(msg.Value, msg.Headers, ApicurioValueGlobalIDHeader); err != nil {
+			return newErrDecode(msg, msg.Value, err)
+		}
+		if !found && ac.wireFormat == WireFormatApicurioHeaders {
+			return newErrDecode(msg, data, errors.Errorf("missing %s header", ApicurioValueGlobalIDHeader))
+		}
+	}
+	var err error
+	if deserializer, ok := ac.deserializer.(ContextDeserializer); ok {
+		err = deserializer.DeserializeContext(ctx, data, v)
+	} else {
+		err = ac.deserializer.Deserialize(data, v)
 	}
-	schemaId := binary.BigEndian.Uint32(data[1:5])
-	schema, err := ac.srClient.GetSchemaByID(int(schemaId))
 	if err != nil {
-		return err
+		return newErrDecode(msg, data, err)
 	}
+	return nil
+}
 
-	return ac.avroAPI.Unmarshal(schema, data[5:], v)
+// newErrDecode wraps the decode failure of the message, the schema ID is read from data when it carries one
+func newErrDecode(msg *kafka.Message, data []byte, err error) error {
+	decodeErr := ErrDecode{
+		Partition: msg.TopicPartition.Partition,
+		Offset:    msg.TopicPartition.Offset,
+		Err:       err,
+	}
+	if msg.TopicPartition.Topic != nil {
+		decodeErr.Topic = *msg.TopicPartition.Topic
+	}
+	if schemaID, _, idErr := readSchemaID(data, WireFormatAuto); idErr == nil {
+		decodeErr.SchemaID = schemaID
+	}
+	return decodeErr
 }
 
 // EnsureTopics returns error if one of the consumed topics
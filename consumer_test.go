@@ -59,3 +59,38 @@ func (m *mockKafkaConsumer) GetMetadata(topic *string, allTopics bool, timeoutMs
 	ret := m.Called(topic, allTopics, timeoutMs)
 	return ret.Get(0).(*kafka.Metadata), ret.Error(1)
 }
+
+func (m *mockKafkaConsumer) Assignment() (partitions []kafka.TopicPartition, err error) {
+	ret := m.Called()
+	return ret.Get(0).([]kafka.TopicPartition), ret.Error(1)
+}
+
+func (m *mockKafkaConsumer) Committed(partitions []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error) {
+	ret := m.Called(partitions, timeoutMs)
+	return ret.Get(0).([]kafka.TopicPartition), ret.Error(1)
+}
+
+func (m *mockKafkaConsumer) Position(partitions []kafka.TopicPartition) (offsets []kafka.TopicPartition, err error) {
+	ret := m.Called(partitions)
+	return ret.Get(0).([]kafka.TopicPartition), ret.Error(1)
+}
+
+func (m *mockKafkaConsumer) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error) {
+	ret := m.Called(topic, partition, timeoutMs)
+	return ret.Get(0).(int64), ret.Get(1).(int64), ret.Error(2)
+}
+
+func (m *mockKafkaConsumer) OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error) {
+	ret := m.Called(times, timeoutMs)
+	return ret.Get(0).([]kafka.TopicPartition), ret.Error(1)
+}
+
+func (m *mockKafkaConsumer) Seek(partition kafka.TopicPartition, timeoutMs int) error {
+	ret := m.Called(partition, timeoutMs)
+	return ret.Error(0)
+}
+
+func (m *mockKafkaConsumer) Assign(partitions []kafka.TopicPartition) (err error) {
+	ret := m.Called(partitions)
+	return ret.Error(0)
+}
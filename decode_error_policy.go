@@ -0,0 +1,49 @@
+package kafkaavro
+
+import "errors"
+
+// DecodeErrorPolicy decides what the consumer does with a message that cannot be decoded.
+// Returning nil skips the message, returning an error fails the fetch with it.
+// The error passed to the policy is an ErrDecode.
+//
+// Skipped messages are not committed by the consumer, except with SkipAndCommitDecodeErrors. Their offset
+// is committed with the next message committed on the partition, or by the auto commit of offsets stored
+// as messages are polled when enable.auto.commit is set.
+type DecodeErrorPolicy func(msg *Message, err error) error
+
+// errSkipAndCommit is returned by policies skipping the message after committing its offset
+var errSkipAndCommit = errors.New("skip and commit message")
+
+// FailOnDecodeError returns messages that cannot be decoded along with the error, this is the default policy
+func FailOnDecodeError() DecodeErrorPolicy {
+	return func(msg *Message, err error) error {
+		return err
+	}
+}
+
+// SkipDecodeErrors skips messages that cannot be decoded
+func SkipDecodeErrors() DecodeErrorPolicy {
+	return func(msg *Message, err error) error {
+		return nil
+	}
+}
+
+// SkipAndCommitDecodeErrors skips messages that cannot be decoded and synchronously commits their offset,
+// so they are not fetched again after a restart when no later message of the partition gets committed.
+// The commit also covers messages of the partition fetched before and not processed yet, as ReadMessage
+// does, use SkipDecodeErrors when messages are committed after being processed out of order.
+// A commit failure fails the fetch with an ErrFailedCommit. Custom policies skip and commit a message by
+// returning the result of this policy.
+func SkipAndCommitDecodeErrors() DecodeErrorPolicy {
+	return func(msg *Message, err error) error {
+		return errSkipAndCommit
+	}
+}
+
+// LogDecodeErrors skips messages that cannot be decoded after passing them to the callback
+func LogDecodeErrors(callback func(msg *Message, err error)) DecodeErrorPolicy {
+	return func(msg *Message, err error) error {
+		callback(msg, err)
+		return nil
+	}
+}
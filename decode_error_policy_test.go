@@ -0,0 +1,193 @@
+package kafkaavro_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newDecodeErrorConsumer(t *testing.T, opts ...kafkaavro.ConsumerOption) (*kafkaavro.Consumer, *mockKafkaConsumer) {
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		append([]kafkaavro.ConsumerOption{
+			kafkaavro.WithKafkaConsumer(kc),
+			kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		}, opts...)...,
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	kc.On("Poll", 100).Return(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          []byte{1, 0, 0, 0, 1, 4},
+	})
+	return c, kc
+}
+
+func TestConsumer_FailOnDecodeError(t *testing.T) {
+	c, kc := newDecodeErrorConsumer(t)
+
+	msg, err := c.FetchMessage(100)
+	assert.True(t, kafkaavro.IsErrInvalidMagicByte(err))
+	assert.NotNil(t, msg)
+	kc.AssertNotCalled(t, "CommitMessage", mock.Anything)
+}
+
+func TestConsumer_SkipDecodeErrors(t *testing.T) {
+	c, kc := newDecodeErrorConsumer(t, kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipDecodeErrors()))
+
+	msg, err := c.ReadMessage(100)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	kc.AssertNotCalled(t, "CommitMessage", mock.Anything)
+}
+
+func TestConsumer_SkipAndCommitDecodeErrors(t *testing.T) {
+	c, kc := newDecodeErrorConsumer(t, kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipAndCommitDecodeErrors()))
+	kc.On("CommitMessage", mock.AnythingOfType("*kafka.Message")).Return([]kafka.TopicPartition{}, nil)
+
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	kc.AssertNumberOfCalls(t, "CommitMessage", 1)
+	committed := kc.Calls[len(kc.Calls)-1].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte{1, 0, 0, 0, 1, 4}, committed.Value)
+}
+
+func TestConsumer_SkipAndCommitDecodeErrorsLastMessage(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 1)
+	topic := "topic"
+	require.NoError(t, broker.NewKafkaProducer().Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0},
+		Value:          []byte("garbage"),
+	}, nil))
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"topic"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipAndCommitDecodeErrors()),
+	)
+	require.NoError(t, err)
+
+	// the undecodable last message of the partition is not fetched again by the group
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	assert.Equal(t, kafka.Offset(1), broker.CommittedOffset("group", "topic", 0))
+}
+
+func TestConsumer_SkipAndCommitDecodeErrorsFailedCommit(t *testing.T) {
+	c, kc := newDecodeErrorConsumer(t, kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipAndCommitDecodeErrors()))
+	kc.On("CommitMessage", mock.AnythingOfType("*kafka.Message")).Return([]kafka.TopicPartition{}, errors.New("commit failed"))
+
+	msg, err := c.FetchMessage(100)
+	assert.True(t, kafkaavro.IsErrFailedCommit(err))
+	assert.Nil(t, msg)
+}
+
+func TestConsumer_SkipDecodeErrorsAfterUncommittedMessage(t *testing.T) {
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	serializer, err := kafkaavro.NewAvroSerializer(srClient, "topic-value", avro.MustParse(`"string"`))
+	require.NoError(t, err)
+	value, err := serializer.Serialize("first")
+	require.NoError(t, err)
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 1)
+	kp := broker.NewKafkaProducer()
+	topic := "topic"
+	for _, v := range [][]byte{value, []byte("garbage"), value} {
+		require.NoError(t, kp.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0},
+			Value:          v,
+		}, nil))
+	}
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"topic"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipDecodeErrors()),
+	)
+	require.NoError(t, err)
+
+	// the first message is still being processed when the next one is skipped
+	first, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	require.NotNil(t, first)
+	skipped, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Nil(t, skipped)
+	assert.Equal(t, kafka.OffsetInvalid, broker.CommittedOffset("group", "topic", 0))
+
+	_, err = c.CommitMessage(first.Message)
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Offset(1), broker.CommittedOffset("group", "topic", 0))
+
+	// the skipped message is committed along with the following one
+	last, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	_, err = c.CommitMessage(last.Message)
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Offset(3), broker.CommittedOffset("group", "topic", 0))
+}
+
+func TestConsumer_LogDecodeErrors(t *testing.T) {
+	var logged []error
+	c, _ := newDecodeErrorConsumer(t, kafkaavro.WithDecodeErrorPolicy(kafkaavro.LogDecodeErrors(func(msg *kafkaavro.Message, err error) {
+		assert.Equal(t, []byte{1, 0, 0, 0, 1, 4}, msg.Message.Value)
+		logged = append(logged, err)
+	})))
+
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	require.Len(t, logged, 1)
+	assert.True(t, kafkaavro.IsErrDecode(logged[0]))
+}
+
+func TestConsumer_DecodeErrorHandler(t *testing.T) {
+	errDeadLetter := errors.New("dead letter topic unavailable")
+	c, kc := newDecodeErrorConsumer(t, kafkaavro.WithDecodeErrorPolicy(func(msg *kafkaavro.Message, err error) error {
+		return errDeadLetter
+	}))
+
+	msg, err := c.ReadMessage(100)
+	assert.Equal(t, errDeadLetter, err)
+	assert.Nil(t, msg)
+	kc.AssertNotCalled(t, "CommitMessage", mock.Anything)
+}
+
+func TestConsumer_SkipDecodeErrorsLogged(t *testing.T) {
+	logger := &recordingLogger{}
+	c, _ := newDecodeErrorConsumer(t,
+		kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipDecodeErrors()),
+		kafkaavro.WithLogger(logger),
+	)
+
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	assert.Equal(t, []string{
+		"DEBUG skipping message that cannot be decoded topic=topic partition=0 offset=0 error=cannot decode message topic[0]@0: invalid magic byte: 0x1",
+	}, logger.entries)
+}
@@ -2,6 +2,9 @@ package kafkaavro
 
 import (
 	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
 )
 
 type ErrInvalidValue struct {
@@ -33,3 +36,185 @@ func (e ErrFailedCommit) Error() string {
 func (e ErrFailedCommit) Unwrap() error {
 	return e.Err
 }
+
+type ErrSchemaNotRegistered struct {
+	Subject string
+}
+
+func (e ErrSchemaNotRegistered) Error() string {
+	return fmt.Sprintf("schema is not registered for subject: %s", e.Subject)
+}
+
+func IsErrSchemaNotRegistered(err error) bool {
+	_, ok := errors.Cause(err).(ErrSchemaNotRegistered)
+	return ok
+}
+
+// ErrDecode is returned by the consumer when a message cannot be decoded,
+// it carries the position of the message and wraps the cause of the failure
+type ErrDecode struct {
+	Topic     string
+	Partition int32
+	Offset    kafka.Offset
+	// SchemaID is the schema ID carried by the message, 0 when it could not be read
+	SchemaID int
+	Err      error
+}
+
+func (e ErrDecode) Error() string {
+	return fmt.Sprintf("cannot decode message %s[%d]@%v: %v", e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+func (e ErrDecode) Unwrap() error {
+	return e.Err
+}
+
+func IsErrDecode(err error) bool {
+	return errors.As(err, &ErrDecode{})
+}
+
+// ErrInvalidMagicByte is returned when data does not start with the magic byte of its wire format
+type ErrInvalidMagicByte struct {
+	MagicByte byte
+}
+
+func (e ErrInvalidMagicByte) Error() string {
+	return fmt.Sprintf("invalid magic byte: %#x", e.MagicByte)
+}
+
+// Is matches any ErrInvalidMagicByte regardless of the magic byte
+func (e ErrInvalidMagicByte) Is(target error) bool {
+	_, ok := target.(ErrInvalidMagicByte)
+	return ok
+}
+
+func IsErrInvalidMagicByte(err error) bool {
+	return errors.Is(err, ErrInvalidMagicByte{})
+}
+
+// ErrTruncatedPayload is returned when data is shorter than its wire format requires
+type ErrTruncatedPayload struct {
+	Length   int
+	Expected int
+}
+
+func (e ErrTruncatedPayload) Error() string {
+	return fmt.Sprintf("payload too short: %d bytes, expected at least %d", e.Length, e.Expected)
+}
+
+// Is matches any ErrTruncatedPayload regardless of the lengths
+func (e ErrTruncatedPayload) Is(target error) bool {
+	_, ok := target.(ErrTruncatedPayload)
+	return ok
+}
+
+func IsErrTruncatedPayload(err error) bool {
+	return errors.Is(err, ErrTruncatedPayload{})
+}
+
+// ErrSchemaNotFound is returned when the schema of a schema ID, subject
+// or single object fingerprint does not exist
+type ErrSchemaNotFound struct {
+	SchemaID    int
+	Subject     string
+	Fingerprint uint64
+	Err         error
+}
+
+func (e ErrSchemaNotFound) Error() string {
+	switch {
+	case e.Subject != "":
+		return fmt.Sprintf("schema not found for subject: %s", e.Subject)
+	case e.Fingerprint != 0:
+		return fmt.Sprintf("schema not found for fingerprint: %016x", e.Fingerprint)
+	default:
+		return fmt.Sprintf("schema not found for id: %d", e.SchemaID)
+	}
+}
+
+func (e ErrSchemaNotFound) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any ErrSchemaNotFound regardless of the schema it reports
+func (e ErrSchemaNotFound) Is(target error) bool {
+	_, ok := target.(ErrSchemaNotFound)
+	return ok
+}
+
+func IsErrSchemaNotFound(err error) bool {
+	return errors.Is(err, ErrSchemaNotFound{})
+}
+
+// ErrRegistryUnavailable is returned when the schema registry could not be reached
+// or failed with a server error, the request may succeed when retried
+type ErrRegistryUnavailable struct {
+	Err error
+}
+
+func (e ErrRegistryUnavailable) Error() string {
+	return fmt.Sprintf("schema registry unavailable: %v", e.Err)
+}
+
+func (e ErrRegistryUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any ErrRegistryUnavailable regardless of its cause
+func (e ErrRegistryUnavailable) Is(target error) bool {
+	_, ok := target.(ErrRegistryUnavailable)
+	return ok
+}
+
+func IsErrRegistryUnavailable(err error) bool {
+	return errors.Is(err, ErrRegistryUnavailable{})
+}
+
+// ErrSchemaIncompatible is returned when the registry rejects a schema
+// that is not compatible with the versions registered to the subject
+type ErrSchemaIncompatible struct {
+	Subject string
+	Err     error
+}
+
+func (e ErrSchemaIncompatible) Error() string {
+	return fmt.Sprintf("schema is incompatible for subject %s: %v", e.Subject, e.Err)
+}
+
+func (e ErrSchemaIncompatible) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any ErrSchemaIncompatible regardless of the subject
+func (e ErrSchemaIncompatible) Is(target error) bool {
+	_, ok := target.(ErrSchemaIncompatible)
+	return ok
+}
+
+func IsErrSchemaIncompatible(err error) bool {
+	return errors.Is(err, ErrSchemaIncompatible{})
+}
+
+// ErrFatal is returned by the consumer once kafka reported a fatal error,
+// the consumer cannot be used anymore and must be closed
+type ErrFatal struct {
+	Err kafka.Error
+}
+
+func (e ErrFatal) Error() string {
+	return fmt.Sprintf("fatal kafka error: %v", e.Err)
+}
+
+func (e ErrFatal) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any ErrFatal regardless of its cause
+func (e ErrFatal) Is(target error) bool {
+	_, ok := target.(ErrFatal)
+	return ok
+}
+
+func IsErrFatal(err error) bool {
+	return errors.Is(err, ErrFatal{})
+}
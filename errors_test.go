@@ -0,0 +1,59 @@
+package kafkaavro_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_DecodeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    []byte
+		target   error
+		schemaID int
+	}{
+		{name: "invalid magic byte", value: []byte{1, 0, 0, 0, 1, 4}, target: kafkaavro.ErrInvalidMagicByte{}},
+		{name: "truncated payload", value: []byte{0, 0}, target: kafkaavro.ErrTruncatedPayload{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := consumeWithWireFormat(t, &kafka.Message{
+				TopicPartition: kafka.TopicPartition{Partition: 2, Offset: 42},
+				Value:          tt.value,
+			})
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tt.target))
+			assert.True(t, kafkaavro.IsErrDecode(err))
+
+			var decodeErr kafkaavro.ErrDecode
+			require.True(t, errors.As(err, &decodeErr))
+			assert.Equal(t, "topic", decodeErr.Topic)
+			assert.Equal(t, int32(2), decodeErr.Partition)
+			assert.Equal(t, kafka.Offset(42), decodeErr.Offset)
+		})
+	}
+}
+
+func TestConsumer_DecodeErrorSchemaID(t *testing.T) {
+	// a value that does not decode with the "string" schema returned by the mock registry
+	_, err := consumeWithWireFormat(t, &kafka.Message{Value: []byte{0, 0, 0, 0, 7, 1}})
+	require.Error(t, err)
+
+	var decodeErr kafkaavro.ErrDecode
+	require.True(t, errors.As(err, &decodeErr))
+	assert.Equal(t, 7, decodeErr.SchemaID)
+}
+
+func TestErrTruncatedPayload(t *testing.T) {
+	var target kafkaavro.ErrTruncatedPayload
+	err := kafkaavro.NewAvroDeserializer(&mockSchemaRegistryClient{}).Deserialize([]byte{0, 0, 1}, new(string))
+	require.True(t, errors.As(err, &target))
+	assert.Equal(t, kafkaavro.ErrTruncatedPayload{Length: 3, Expected: 5}, target)
+	assert.True(t, kafkaavro.IsErrTruncatedPayload(err))
+	assert.False(t, kafkaavro.IsErrInvalidMagicByte(err))
+}
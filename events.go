@@ -0,0 +1,71 @@
+package kafkaavro
+
+import "github.com/confluentinc/confluent-kafka-go/kafka"
+
+// EventHandlers receive the kafka events other than messages polled by the consumer by type,
+// events without a handler are passed to the EventHandler
+type EventHandlers struct {
+	// OnError receives kafka errors. Transient errors are retried by the kafka client,
+	// after a fatal error the consumer is unusable and FetchMessage returns ErrFatal.
+	OnError func(err kafka.Error, fatal bool)
+	// OnPartitionEOF receives the partition and offset whenever the end of a partition is reached,
+	// which requires enable.partition.eof
+	OnPartitionEOF func(partition kafka.TopicPartition)
+	// OnOffsetsCommitted receives the result of offset commits made in the background,
+	// such as automatic commits
+	OnOffsetsCommitted func(offsets []kafka.TopicPartition, err error)
+	// OnStats receives the statistics emitted every statistics.interval.ms
+	OnStats func(stats *kafka.Stats)
+}
+
+// dispatchEvent passes the event to its typed handler or to the event handler,
+// fatal errors are returned and remembered so the consumer keeps reporting them
+func (ac *Consumer) dispatchEvent(event kafka.Event) error {
+	switch e := event.(type) {
+	case kafka.Error:
+		fatal := e.IsFatal()
+		if ac.eventHandlers.OnError != nil {
+			ac.eventHandlers.OnError(e, fatal)
+		} else {
+			ac.eventHandler(e)
+		}
+		if fatal {
+			err := ErrFatal{Err: e}
+			ac.fatalMu.Lock()
+			ac.fatalErr = err
+			ac.fatalMu.Unlock()
+			return err
+		}
+	case kafka.PartitionEOF:
+		if ac.eventHandlers.OnPartitionEOF != nil {
+			ac.eventHandlers.OnPartitionEOF(kafka.TopicPartition(e))
+		} else {
+			ac.eventHandler(e)
+		}
+	case kafka.OffsetsCommitted:
+		if ac.eventHandlers.OnOffsetsCommitted != nil {
+			ac.eventHandlers.OnOffsetsCommitted(e.Offsets, e.Error)
+		} else {
+			ac.eventHandler(e)
+		}
+	case *kafka.Stats:
+		if ac.statsHandler != nil {
+			handleStats(ac.statsHandler, ac.logger, e)
+		}
+		if ac.eventHandlers.OnStats != nil {
+			ac.eventHandlers.OnStats(e)
+		} else if ac.statsHandler == nil {
+			ac.eventHandler(e)
+		}
+	default:
+		ac.eventHandler(e)
+	}
+	return nil
+}
+
+// fatalError returns the fatal error reported by kafka, if any
+func (ac *Consumer) fatalError() error {
+	ac.fatalMu.Lock()
+	defer ac.fatalMu.Unlock()
+	return ac.fatalErr
+}
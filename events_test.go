@@ -0,0 +1,117 @@
+package kafkaavro_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEventsConsumer(t *testing.T, kc *mockKafkaConsumer, opts ...kafkaavro.ConsumerOption) *kafkaavro.Consumer {
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		append([]kafkaavro.ConsumerOption{
+			kafkaavro.WithKafkaConsumer(kc),
+			kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		}, opts...)...,
+	)
+	require.NoError(t, err)
+	return c
+}
+
+func TestConsumer_EventHandlers(t *testing.T) {
+	var (
+		errs      []kafka.Error
+		eofs      []kafka.TopicPartition
+		committed []kafka.TopicPartition
+		stats     []string
+		other     []kafka.Event
+	)
+	kc := &mockKafkaConsumer{}
+	c := newEventsConsumer(t, kc,
+		kafkaavro.WithEventHandlers(kafkaavro.EventHandlers{
+			OnError: func(err kafka.Error, fatal bool) {
+				assert.False(t, fatal)
+				errs = append(errs, err)
+			},
+			OnPartitionEOF: func(partition kafka.TopicPartition) {
+				eofs = append(eofs, partition)
+			},
+			OnOffsetsCommitted: func(offsets []kafka.TopicPartition, err error) {
+				assert.NoError(t, err)
+				committed = append(committed, offsets...)
+			},
+			OnStats: func(s *kafka.Stats) {
+				stats = append(stats, s.String())
+			},
+		}),
+		kafkaavro.WithEventHandler(func(event kafka.Event) {
+			other = append(other, event)
+		}),
+	)
+
+	topic := "topic"
+	partition := kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 5}
+	events := []kafka.Event{
+		kafka.NewError(kafka.ErrTransport, "broker down", false),
+		kafka.PartitionEOF(partition),
+		kafka.OffsetsCommitted{Offsets: []kafka.TopicPartition{partition}},
+		&kafka.Stats{},
+		kafka.AssignedPartitions{Partitions: []kafka.TopicPartition{partition}},
+	}
+	for _, event := range events {
+		kc.On("Poll", 100).Return(event).Once()
+		msg, err := c.FetchMessage(100)
+		require.NoError(t, err)
+		assert.Nil(t, msg)
+	}
+
+	assert.Len(t, errs, 1)
+	assert.Equal(t, []kafka.TopicPartition{partition}, eofs)
+	assert.Equal(t, []kafka.TopicPartition{partition}, committed)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, []kafka.Event{events[4]}, other)
+}
+
+func TestConsumer_EventHandlerFallback(t *testing.T) {
+	var events []kafka.Event
+	kc := &mockKafkaConsumer{}
+	c := newEventsConsumer(t, kc, kafkaavro.WithEventHandler(func(event kafka.Event) {
+		events = append(events, event)
+	}))
+
+	kc.On("Poll", 100).Return(kafka.NewError(kafka.ErrTransport, "broker down", false)).Once()
+	_, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestConsumer_FatalError(t *testing.T) {
+	var fatal bool
+	kc := &mockKafkaConsumer{}
+	c := newEventsConsumer(t, kc, kafkaavro.WithEventHandlers(kafkaavro.EventHandlers{
+		OnError: func(err kafka.Error, isFatal bool) {
+			fatal = isFatal
+		},
+	}))
+
+	kc.On("Poll", 100).Return(kafka.NewError(kafka.ErrFatal, "fenced", true)).Once()
+	msg, err := c.FetchMessage(100)
+	assert.Nil(t, msg)
+	assert.True(t, fatal)
+	assert.True(t, kafkaavro.IsErrFatal(err))
+	var kafkaErr kafka.Error
+	require.True(t, errors.As(err, &kafkaErr))
+	assert.Equal(t, kafka.ErrFatal, kafkaErr.Code())
+
+	// the consumer keeps reporting the fatal error without polling
+	_, err = c.ReadMessage(100)
+	assert.True(t, kafkaavro.IsErrFatal(err))
+	kc.AssertNumberOfCalls(t, "Poll", 1)
+}
@@ -0,0 +1,109 @@
+package kafkaavro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fileCache persists schemas and registered ids to a directory so they
+// can be served while the schema registry is unreachable. Schemas are stored
+// as <dir>/schemas/<id>.avsc, along with the JSON array of the schemas they reference
+// in <dir>/schemas/<id>.refs.json, and registered ids as <dir>/subjects/<subject>/<fingerprint>.id.
+type fileCache struct {
+	dir string
+}
+
+func newFileCache(dir string) (*fileCache, error) {
+	for _, sub := range []string{"schemas", "subjects"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &fileCache{dir: dir}, nil
+}
+
+func (fc *fileCache) schemaPath(id int) string {
+	return filepath.Join(fc.dir, "schemas", strconv.Itoa(id)+".avsc")
+}
+
+func (fc *fileCache) referencesPath(id int) string {
+	return filepath.Join(fc.dir, "schemas", strconv.Itoa(id)+".refs.json")
+}
+
+func (fc *fileCache) registeredPath(subject string, fingerprint [32]byte) string {
+	return filepath.Join(fc.dir, "subjects", url.PathEscape(subject), fmt.Sprintf("%x.id", fingerprint))
+}
+
+// GetSchema returns the persisted schema JSON with the given id and the schemas it references
+func (fc *fileCache) GetSchema(id int) (string, []string, error) {
+	data, err := ioutil.ReadFile(fc.schemaPath(id))
+	if err != nil {
+		return "", nil, err
+	}
+	var referenced []string
+	refs, err := ioutil.ReadFile(fc.referencesPath(id))
+	if err == nil {
+		err = json.Unmarshal(refs, &referenced)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", nil, err
+	}
+	return string(data), referenced, nil
+}
+
+// PutSchema persists the schema JSON with the given id and the schemas it references,
+// references are written first so a schema file is never read without them
+func (fc *fileCache) PutSchema(id int, schemaJSON string, referenced []string) error {
+	if len(referenced) > 0 {
+		refs, err := json.Marshal(referenced)
+		if err != nil {
+			return err
+		}
+		if err = fc.write(fc.referencesPath(id), refs); err != nil {
+			return err
+		}
+	}
+	return fc.write(fc.schemaPath(id), []byte(schemaJSON))
+}
+
+// GetRegisteredID returns the persisted id of a schema registered to the subject
+func (fc *fileCache) GetRegisteredID(subject string, fingerprint [32]byte) (int, error) {
+	data, err := ioutil.ReadFile(fc.registeredPath(subject, fingerprint))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// PutRegisteredID persists the id of a schema registered to the subject
+func (fc *fileCache) PutRegisteredID(subject string, fingerprint [32]byte, id int) error {
+	path := fc.registeredPath(subject, fingerprint)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return fc.write(path, []byte(strconv.Itoa(id)))
+}
+
+// write replaces the file atomically so readers never see partial content
+func (fc *fileCache) write(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
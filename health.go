@@ -0,0 +1,185 @@
+package kafkaavro
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Health is the state of a producer or consumer reported by its Health method
+type Health struct {
+	// Broker is the error of the metadata request made to the brokers, nil when they answered
+	Broker error
+	// Registry is the error of the request made to the schema registry, nil when it answered
+	// or when the schema registry client cannot be pinged
+	Registry error
+	// Fatal is the fatal error reported by kafka, the client must be recreated once it is set
+	Fatal error
+	// Poll is set once the consumer did not poll for longer than max.poll.interval.ms,
+	// after which it has left its consumer group, always nil for producers
+	Poll error
+	// Assigned reports whether partitions are assigned to the consumer, always false for producers
+	Assigned bool
+	// LastPoll is the time of the last consumer poll which did not report an error, zero for producers
+	LastPoll time.Time
+}
+
+// Live reports whether the client can keep working, which is no longer the case after a fatal error
+// or once a consumer stopped polling
+func (h Health) Live() bool {
+	return h.Fatal == nil && h.Poll == nil
+}
+
+// Ready reports whether the client is live and reaches both the brokers and the schema registry.
+// Consumers without assignment are ready, consumer groups may have more members than partitions.
+func (h Health) Ready() bool {
+	return h.Live() && h.Broker == nil && h.Registry == nil
+}
+
+// Problems describes the failed checks
+func (h Health) Problems() []string {
+	var problems []string
+	if h.Fatal != nil {
+		problems = append(problems, "fatal: "+h.Fatal.Error())
+	}
+	if h.Poll != nil {
+		problems = append(problems, "poll: "+h.Poll.Error())
+	}
+	if h.Broker != nil {
+		problems = append(problems, "broker: "+h.Broker.Error())
+	}
+	if h.Registry != nil {
+		problems = append(problems, "schema registry: "+h.Registry.Error())
+	}
+	return problems
+}
+
+// healthCheckTimeout bounds the requests made to the brokers and the schema registry by readiness probes
+const healthCheckTimeout = 5 * time.Second
+
+// HealthChecker is implemented by Producer and Consumer
+type HealthChecker interface {
+	// Liveness reports the state of the client without making any request
+	Liveness() Health
+	// Health also checks the connectivity to the brokers and the schema registry
+	Health(ctx context.Context) Health
+}
+
+// registryPinger is implemented by schema registry clients which can check that the registry answers
+type registryPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// fatalErrorProvider is implemented by kafka clients which report their fatal error
+type fatalErrorProvider interface {
+	GetFatalError() error
+}
+
+// pingRegistry pings the schema registry when its client supports it
+func pingRegistry(ctx context.Context, client SchemaRegistryClient) error {
+	if pinger, ok := client.(registryPinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Liveness reports the fatal error of the producer, if any
+func (p *Producer) Liveness() Health {
+	var h Health
+	if provider, ok := p.KafkaProducer.(fatalErrorProvider); ok {
+		h.Fatal = provider.GetFatalError()
+	}
+	return h
+}
+
+// Health checks the connectivity of the producer to the brokers and the schema registry
+func (p *Producer) Health(ctx context.Context) Health {
+	h := p.Liveness()
+	_, h.Broker = p.KafkaProducer.GetMetadata(nil, false, contextTimeoutMs(ctx))
+	h.Registry = pingRegistry(ctx, p.srClient)
+	return h
+}
+
+// Liveness reports the fatal error of the consumer and its last poll, the consumer is
+// not live once it did not poll for longer than max.poll.interval.ms
+func (ac *Consumer) Liveness() Health {
+	h := Health{Fatal: ac.fatalError()}
+	ac.pollMu.Lock()
+	h.LastPoll = ac.lastPoll
+	ac.pollMu.Unlock()
+	if !h.LastPoll.IsZero() && ac.maxPollInterval > 0 {
+		if since := time.Since(h.LastPoll); since > ac.maxPollInterval {
+			h.Poll = errors.Errorf("no poll for %s, more than max.poll.interval.ms of %s", since.Round(time.Millisecond), ac.maxPollInterval)
+		}
+	}
+	return h
+}
+
+// Health checks the connectivity of the consumer to the brokers and the schema registry
+// and reports its assignment and last poll
+func (ac *Consumer) Health(ctx context.Context) Health {
+	h := ac.Liveness()
+	_, h.Broker = ac.KafkaConsumer.GetMetadata(nil, false, contextTimeoutMs(ctx))
+	h.Registry = pingRegistry(ctx, ac.srClient)
+	if assignment, err := ac.assignment(); err == nil {
+		h.Assigned = len(assignment) > 0
+	}
+	return h
+}
+
+type healthResponse struct {
+	Live     bool     `json:"live"`
+	Ready    *bool    `json:"ready,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// NewHealthHandler returns a handler for liveness and readiness probes checking all the clients.
+// GET /live fails with 503 Service Unavailable once a client is not live, it makes no request.
+// GET /ready fails once a client is not ready, checking the brokers and the schema registry
+// within healthCheckTimeout. The response body describes the failed checks.
+func NewHealthHandler(checkers ...HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path != "/live" && r.URL.Path != "/ready" {
+			http.NotFound(w, r)
+			return
+		}
+
+		res := healthResponse{Live: true}
+		var ok bool
+		if r.URL.Path == "/live" {
+			for _, checker := range checkers {
+				h := checker.Liveness()
+				res.Live = res.Live && h.Live()
+				res.Problems = append(res.Problems, h.Problems()...)
+			}
+			ok = res.Live
+		} else {
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			defer cancel()
+			ready := true
+			for _, checker := range checkers {
+				h := checker.Health(ctx)
+				res.Live = res.Live && h.Live()
+				ready = ready && h.Ready()
+				res.Problems = append(res.Problems, h.Problems()...)
+			}
+			res.Ready = &ready
+			ok = ready
+		}
+
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
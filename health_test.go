@@ -0,0 +1,177 @@
+package kafkaavro_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/mycujoo/go-kafka-avro/v2/registryserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, handler http.Handler, path string) (int, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return rec.Code, body
+}
+
+func TestHealth(t *testing.T) {
+	registry := httptest.NewServer(registryserver.New())
+	defer registry.Close()
+	srClient, err := kafkaavro.NewCachedSchemaRegistryClient(registry.URL)
+	require.NoError(t, err)
+
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 1)
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+	)
+	require.NoError(t, err)
+	c, err := kafkaavro.NewConsumer(
+		[]string{"topic"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+	)
+	require.NoError(t, err)
+
+	h := c.Health(context.Background())
+	assert.True(t, h.Ready())
+	assert.True(t, h.Assigned)
+	assert.True(t, h.LastPoll.IsZero())
+
+	before := time.Now()
+	_, err = c.FetchMessage(10)
+	require.NoError(t, err)
+	assert.False(t, c.Health(context.Background()).LastPoll.Before(before))
+
+	handler := kafkaavro.NewHealthHandler(p, c)
+	code, body := probe(t, handler, "/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"live": true, "ready": true}, body)
+
+	registry.Close()
+	h = p.Health(context.Background())
+	assert.True(t, h.Live())
+	assert.False(t, h.Ready())
+	assert.True(t, kafkaavro.IsErrRegistryUnavailable(h.Registry))
+
+	code, body = probe(t, handler, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, false, body["ready"])
+	assert.Len(t, body["problems"], 2)
+	code, _ = probe(t, handler, "/live")
+	assert.Equal(t, http.StatusOK, code)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestConsumer_HealthFatal(t *testing.T) {
+	kc := &mockKafkaConsumer{}
+	c := newEventsConsumer(t, kc)
+	kc.On("Poll", 100).Return(kafka.NewError(kafka.ErrFatal, "fenced", true)).Once()
+	kc.On("GetMetadata", (*string)(nil), false, mock.Anything).Return(&kafka.Metadata{}, nil)
+	kc.On("Assignment").Return([]kafka.TopicPartition{}, nil)
+	_, err := c.FetchMessage(100)
+	require.Error(t, err)
+
+	h := c.Health(context.Background())
+	assert.True(t, kafkaavro.IsErrFatal(h.Fatal))
+	assert.False(t, h.Live())
+	assert.False(t, h.Assigned)
+	assert.True(t, h.LastPoll.IsZero())
+
+	code, body := probe(t, kafkaavro.NewHealthHandler(c), "/live")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []interface{}{"fatal: " + err.Error()}, body["problems"])
+}
+
+func TestProducer_HealthBrokerUnreachable(t *testing.T) {
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaConfig(&kafka.ConfigMap{"bootstrap.servers": "127.0.0.1:1"}),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithLogger(kafkaavro.NopLogger()),
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	h := p.Health(ctx)
+	assert.Error(t, h.Broker)
+	assert.NoError(t, h.Registry)
+	assert.True(t, h.Live())
+	assert.False(t, h.Ready())
+}
+
+func TestConsumer_LivenessStalledPoll(t *testing.T) {
+	kc := &mockKafkaConsumer{}
+	// no GetMetadata expectation is set, the liveness probe makes no request
+	c := newEventsConsumer(t, kc, kafkaavro.WithKafkaConfig(&kafka.ConfigMap{"max.poll.interval.ms": 20}))
+	topic := "topic"
+	kc.On("Poll", 100).Return(kafka.PartitionEOF{Topic: &topic}).Once()
+	_, err := c.FetchMessage(100)
+	require.NoError(t, err)
+
+	handler := kafkaavro.NewHealthHandler(c)
+	code, body := probe(t, handler, "/live")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"live": true}, body)
+
+	time.Sleep(30 * time.Millisecond)
+	h := c.Liveness()
+	assert.Error(t, h.Poll)
+	assert.False(t, h.Live())
+	code, body = probe(t, handler, "/live")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, body["problems"], 1)
+	assert.Contains(t, body["problems"].([]interface{})[0], "poll: no poll for")
+}
+
+// deadlineChecker records the deadline of the context of its health checks
+type deadlineChecker struct {
+	deadline time.Time
+}
+
+func (c *deadlineChecker) Liveness() kafkaavro.Health {
+	return kafkaavro.Health{}
+}
+
+func (c *deadlineChecker) Health(ctx context.Context) kafkaavro.Health {
+	c.deadline, _ = ctx.Deadline()
+	return kafkaavro.Health{}
+}
+
+func TestHealthHandler_ReadyTimeout(t *testing.T) {
+	checker := &deadlineChecker{}
+	code, body := probe(t, kafkaavro.NewHealthHandler(checker), "/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]interface{}{"live": true, "ready": true}, body)
+	require.False(t, checker.deadline.IsZero())
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), checker.deadline, time.Second)
+
+	checker.deadline = time.Time{}
+	probe(t, kafkaavro.NewHealthHandler(checker), "/live")
+	assert.True(t, checker.deadline.IsZero())
+}
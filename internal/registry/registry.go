@@ -0,0 +1,513 @@
+// Package registry implements the subjects, versions, ids and compatibility rules
+// of a schema registry, shared by the in-memory test client and the local registry server.
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/pkg/errors"
+)
+
+// Compatibility levels as named by the schema registry
+const (
+	CompatibilityNone               = "NONE"
+	CompatibilityBackward           = "BACKWARD"
+	CompatibilityBackwardTransitive = "BACKWARD_TRANSITIVE"
+	CompatibilityForward            = "FORWARD"
+	CompatibilityForwardTransitive  = "FORWARD_TRANSITIVE"
+	CompatibilityFull               = "FULL"
+	CompatibilityFullTransitive     = "FULL_TRANSITIVE"
+)
+
+// LatestVersion selects the highest live version of a subject
+const LatestVersion = -1
+
+var (
+	ErrSubjectNotFound           = errors.New("subject not found")
+	ErrVersionNotFound           = errors.New("version not found")
+	ErrSchemaNotFound            = errors.New("schema not found")
+	ErrInvalidCompatibilityLevel = errors.New("invalid compatibility level")
+	ErrReferencedSubjectNotFound = errors.New("referenced subject not found")
+)
+
+// ErrInvalidSchema is returned when an avro schema cannot be parsed
+type ErrInvalidSchema struct {
+	Err error
+}
+
+func (e ErrInvalidSchema) Error() string {
+	return "invalid schema: " + e.Err.Error()
+}
+
+func (e ErrInvalidSchema) Unwrap() error {
+	return e.Err
+}
+
+// Schema is a schema as registered to a subject
+type Schema struct {
+	ID         int
+	Subject    string
+	Version    int
+	SchemaType string
+	Schema     string
+	References []kafkaavro.SchemaReference
+	// Parsed is the parsed schema of avro schemas. When set on schemas passed to the registry
+	// the schema text is not parsed again.
+	Parsed avro.Schema
+}
+
+// Registry stores schemas in memory, optionally persisting them to a file after every change
+type Registry struct {
+	mu sync.RWMutex
+
+	path                 string
+	schemas              []*entry          // indexed by id - 1
+	ids                  map[string]int    // map[key]id
+	subjects             map[string][]int  // map[subject]ids, indexed by version - 1, 0 marks deleted versions
+	compatibility        string            // global compatibility level
+	subjectCompatibility map[string]string // map[subject]compatibility level
+	checker              *avro.SchemaCompatibility
+}
+
+type entry struct {
+	SchemaType string                      `json:"schemaType"`
+	Schema     string                      `json:"schema"`
+	References []kafkaavro.SchemaReference `json:"references,omitempty"`
+
+	parsed avro.Schema
+}
+
+// state is the persisted form of the registry
+type state struct {
+	Schemas              []*entry          `json:"schemas"`
+	Subjects             map[string][]int  `json:"subjects"`
+	Compatibility        string            `json:"compatibility"`
+	SubjectCompatibility map[string]string `json:"subjectCompatibility"`
+}
+
+// New returns an empty in-memory registry
+func New() *Registry {
+	return &Registry{
+		ids:                  make(map[string]int),
+		subjects:             make(map[string][]int),
+		compatibility:        CompatibilityBackward,
+		subjectCompatibility: make(map[string]string),
+		checker:              avro.NewSchemaCompatibility(),
+	}
+}
+
+// Open returns a registry persisted to the file, loading the schemas it already contains
+func Open(path string) (*Registry, error) {
+	r := New()
+	r.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, errors.Wrapf(err, "cannot read %s", path)
+	}
+	for subject, ids := range s.Subjects {
+		r.subjects[subject] = ids
+	}
+	// schemas are parsed in id order, referenced schemas are always registered first
+	for _, e := range s.Schemas {
+		if e.SchemaType == kafkaavro.SchemaTypeAvro {
+			if e.parsed, err = r.parse(e.Schema, e.References); err != nil {
+				return nil, errors.Wrapf(err, "cannot read %s", path)
+			}
+		}
+		r.schemas = append(r.schemas, e)
+		r.ids[key(e)] = len(r.schemas)
+	}
+	if s.Compatibility != "" {
+		r.compatibility = s.Compatibility
+	}
+	for subject, level := range s.SubjectCompatibility {
+		r.subjectCompatibility[subject] = level
+	}
+	return r, nil
+}
+
+// Register adds the schema to the subject unless it is already registered there and returns its id.
+// One id is assigned per distinct schema across subjects.
+func (r *Registry) Register(subject string, schema Schema) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.newEntry(schema)
+	if err != nil {
+		return 0, err
+	}
+	if _, id, found := r.lookup(subject, e); found {
+		return id, nil
+	}
+	if err = r.checkCompatibility(subject, e, r.versionsToCheck(subject)); err != nil {
+		return 0, err
+	}
+	id, ok := r.ids[key(e)]
+	if !ok {
+		r.schemas = append(r.schemas, e)
+		id = len(r.schemas)
+		r.ids[key(e)] = id
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	return id, r.save()
+}
+
+// Lookup returns the schema as registered to the subject
+func (r *Registry) Lookup(subject string, schema Schema) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.subjects[subject]; !ok {
+		return Schema{}, ErrSubjectNotFound
+	}
+	e, err := r.newEntry(schema)
+	if err != nil {
+		return Schema{}, err
+	}
+	version, id, found := r.lookup(subject, e)
+	if !found {
+		return Schema{}, ErrSchemaNotFound
+	}
+	return r.schema(id, subject, version), nil
+}
+
+// SchemaByID returns the schema with the id
+func (r *Registry) SchemaByID(id int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id <= 0 || id > len(r.schemas) {
+		return Schema{}, ErrSchemaNotFound
+	}
+	return r.schema(id, "", 0), nil
+}
+
+// Version returns a version of the subject, LatestVersion selects the highest live version
+func (r *Registry) Version(subject string, version int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	version, id, err := r.version(subject, version)
+	if err != nil {
+		return Schema{}, err
+	}
+	return r.schema(id, subject, version), nil
+}
+
+// Subjects returns the sorted list of subjects
+func (r *Registry) Subjects() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	subjects := make([]string, 0, len(r.subjects))
+	for subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+	return subjects
+}
+
+// Versions returns the live versions of the subject
+func (r *Registry) Versions(subject string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids, ok := r.subjects[subject]
+	if !ok {
+		return nil, ErrSubjectNotFound
+	}
+	return liveVersions(ids), nil
+}
+
+// DeleteSubject deletes the subject and returns the versions it had, schemas remain available by id
+func (r *Registry) DeleteSubject(subject string) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids, ok := r.subjects[subject]
+	if !ok {
+		return nil, ErrSubjectNotFound
+	}
+	delete(r.subjects, subject)
+	delete(r.subjectCompatibility, subject)
+	return liveVersions(ids), r.save()
+}
+
+// DeleteVersion deletes a version of the subject and returns it, the subject
+// is deleted along with its last version
+func (r *Registry) DeleteVersion(subject string, version int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	version, _, err := r.version(subject, version)
+	if err != nil {
+		return 0, err
+	}
+	ids := r.subjects[subject]
+	ids[version-1] = 0
+	if len(liveVersions(ids)) == 0 {
+		delete(r.subjects, subject)
+		delete(r.subjectCompatibility, subject)
+	}
+	return version, r.save()
+}
+
+// Compatibility returns the compatibility level of the subject, or the global level for an empty subject
+func (r *Registry) Compatibility(subject string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.level(subject)
+}
+
+// SetCompatibility sets the compatibility level of the subject, or the global level for an empty subject
+func (r *Registry) SetCompatibility(subject string, level string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch level {
+	case CompatibilityNone, CompatibilityBackward, CompatibilityBackwardTransitive, CompatibilityForward,
+		CompatibilityForwardTransitive, CompatibilityFull, CompatibilityFullTransitive:
+	default:
+		return ErrInvalidCompatibilityLevel
+	}
+	if subject == "" {
+		r.compatibility = level
+	} else {
+		r.subjectCompatibility[subject] = level
+	}
+	return r.save()
+}
+
+// CheckCompatibility checks the schema against a version of the subject with the compatibility level of the subject,
+// with LatestVersion it checks against every version the level requires, as registering the schema would
+func (r *Registry) CheckCompatibility(subject string, version int, schema Schema) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, err := r.newEntry(schema)
+	if err != nil {
+		return err
+	}
+	if version == LatestVersion {
+		if _, ok := r.subjects[subject]; !ok {
+			return ErrSubjectNotFound
+		}
+		return r.checkCompatibility(subject, e, r.versionsToCheck(subject))
+	}
+	_, id, err := r.version(subject, version)
+	if err != nil {
+		return err
+	}
+	return r.checkCompatibility(subject, e, []int{id})
+}
+
+func (r *Registry) newEntry(schema Schema) (*entry, error) {
+	e := &entry{SchemaType: schema.SchemaType, Schema: schema.Schema, References: schema.References, parsed: schema.Parsed}
+	if e.SchemaType == "" {
+		e.SchemaType = kafkaavro.SchemaTypeAvro
+	}
+	if e.SchemaType == kafkaavro.SchemaTypeAvro && e.parsed == nil {
+		parsed, err := r.parse(e.Schema, e.References)
+		if err != nil {
+			return nil, err
+		}
+		e.parsed = parsed
+	}
+	return e, nil
+}
+
+func (r *Registry) schema(id int, subject string, version int) Schema {
+	e := r.schemas[id-1]
+	return Schema{
+		ID:         id,
+		Subject:    subject,
+		Version:    version,
+		SchemaType: e.SchemaType,
+		Schema:     e.Schema,
+		References: e.References,
+		Parsed:     e.parsed,
+	}
+}
+
+// lookup returns the version and id of the schema within the subject
+func (r *Registry) lookup(subject string, e *entry) (int, int, bool) {
+	id, ok := r.ids[key(e)]
+	if !ok {
+		return 0, 0, false
+	}
+	for i, versionID := range r.subjects[subject] {
+		if versionID == id {
+			return i + 1, id, true
+		}
+	}
+	return 0, 0, false
+}
+
+// version resolves a live version of the subject and its id
+func (r *Registry) version(subject string, version int) (int, int, error) {
+	ids, ok := r.subjects[subject]
+	if !ok {
+		return 0, 0, ErrSubjectNotFound
+	}
+	if version == LatestVersion {
+		for i := len(ids) - 1; i >= 0; i-- {
+			if ids[i] != 0 {
+				return i + 1, ids[i], nil
+			}
+		}
+		return 0, 0, ErrVersionNotFound
+	}
+	if version <= 0 || version > len(ids) || ids[version-1] == 0 {
+		return 0, 0, ErrVersionNotFound
+	}
+	return version, ids[version-1], nil
+}
+
+func (r *Registry) level(subject string) string {
+	if level, ok := r.subjectCompatibility[subject]; ok {
+		return level
+	}
+	return r.compatibility
+}
+
+// versionsToCheck returns the ids a new version of the subject must be compatible with
+func (r *Registry) versionsToCheck(subject string) []int {
+	switch r.level(subject) {
+	case CompatibilityBackwardTransitive, CompatibilityForwardTransitive, CompatibilityFullTransitive:
+		return r.subjects[subject]
+	case CompatibilityNone:
+		return nil
+	}
+	if _, id, err := r.version(subject, LatestVersion); err == nil {
+		return []int{id}
+	}
+	return nil
+}
+
+// checkCompatibility checks an avro schema against the schemas with the ids, other schema types are not checked
+func (r *Registry) checkCompatibility(subject string, e *entry, ids []int) error {
+	if e.parsed == nil {
+		return nil
+	}
+	level := r.level(subject)
+	for _, id := range ids {
+		if id == 0 || r.schemas[id-1].parsed == nil {
+			continue
+		}
+		previous := r.schemas[id-1].parsed
+		var err error
+		switch level {
+		case CompatibilityNone:
+		case CompatibilityBackward, CompatibilityBackwardTransitive:
+			err = r.checker.Compatible(e.parsed, previous)
+		case CompatibilityForward, CompatibilityForwardTransitive:
+			err = r.checker.Compatible(previous, e.parsed)
+		case CompatibilityFull, CompatibilityFullTransitive:
+			if err = r.checker.Compatible(e.parsed, previous); err == nil {
+				err = r.checker.Compatible(previous, e.parsed)
+			}
+		default:
+			return ErrInvalidCompatibilityLevel
+		}
+		if err != nil {
+			return kafkaavro.ErrSchemaIncompatible{Subject: subject, Err: err}
+		}
+	}
+	return nil
+}
+
+// parse parses the avro schema JSON after the avro schemas it references
+func (r *Registry) parse(schema string, references []kafkaavro.SchemaReference) (avro.Schema, error) {
+	cache := &avro.SchemaCache{}
+	if err := r.resolveReferences(references, cache, map[kafkaavro.SchemaReference]bool{}); err != nil {
+		return nil, err
+	}
+	parsed, err := avro.ParseWithCache(schema, "", cache)
+	if err != nil {
+		return nil, ErrInvalidSchema{Err: err}
+	}
+	return parsed, nil
+}
+
+func (r *Registry) resolveReferences(references []kafkaavro.SchemaReference, cache *avro.SchemaCache, resolved map[kafkaavro.SchemaReference]bool) error {
+	for _, ref := range references {
+		if resolved[ref] {
+			continue
+		}
+		resolved[ref] = true
+
+		version := ref.Version
+		if version <= 0 {
+			version = LatestVersion
+		}
+		_, id, err := r.version(ref.Subject, version)
+		if err != nil {
+			return errors.Wrapf(ErrReferencedSubjectNotFound, "%s version %d", ref.Subject, ref.Version)
+		}
+		referenced := r.schemas[id-1]
+		if err = r.resolveReferences(referenced.References, cache, resolved); err != nil {
+			return err
+		}
+		if _, err = avro.ParseWithCache(referenced.Schema, "", cache); err != nil {
+			return ErrInvalidSchema{Err: err}
+		}
+	}
+	return nil
+}
+
+// save persists the registry when it is backed by a file, the file is replaced atomically
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(state{
+		Schemas:              r.schemas,
+		Subjects:             r.subjects,
+		Compatibility:        r.compatibility,
+		SubjectCompatibility: r.subjectCompatibility,
+	})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// key identifies distinct schemas, avro schemas without references are compared by canonical form
+func key(e *entry) string {
+	if e.SchemaType == kafkaavro.SchemaTypeAvro && len(e.References) == 0 && e.parsed != nil {
+		return e.SchemaType + "\x00" + e.parsed.String()
+	}
+	k := e.SchemaType + "\x00" + e.Schema
+	for _, ref := range e.References {
+		k += "\x00" + ref.Name + "\x00" + ref.Subject + "\x00" + strconv.Itoa(ref.Version)
+	}
+	return k
+}
+
+func liveVersions(ids []int) []int {
+	versions := make([]int, 0, len(ids))
+	for i, id := range ids {
+		if id != 0 {
+			versions = append(versions, i+1)
+		}
+	}
+	return versions
+}
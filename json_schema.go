@@ -0,0 +1,104 @@
+package kafkaavro
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// JSONSchemaSerializer encodes values as JSON using the Confluent JSON Schema wire format:
+// magic byte, schema ID and the JSON document, which must be valid against the schema
+type JSONSchemaSerializer struct {
+	WireFormat WireFormat
+
+	schemaID int
+	schema   *gojsonschema.Schema
+}
+
+// jsonSchemaBaseURL is the base URL the schema and its references are loaded at,
+// so $ref to reference names relative to the schema resolve to the referenced schemas
+const jsonSchemaBaseURL = "kafkaavro://schemas/"
+
+// NewJSONSchemaSerializer compiles the JSON schema registered under the schema ID
+func NewJSONSchemaSerializer(schemaID int, schema string) (*JSONSchemaSerializer, error) {
+	return NewJSONSchemaSerializerWithReferences(schemaID, schema, nil)
+}
+
+// NewJSONSchemaSerializerWithReferences compiles the JSON schema registered under the schema ID along with
+// the schemas it references, keyed by the reference names used in its $ref
+func NewJSONSchemaSerializerWithReferences(schemaID int, schema string, referenced map[string]string) (*JSONSchemaSerializer, error) {
+	base, err := url.Parse(jsonSchemaBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	loader := gojsonschema.NewSchemaLoader()
+	for name, referencedSchema := range referenced {
+		ref, err := url.Parse(name)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid schema reference %s", name)
+		}
+		if err = loader.AddSchema(base.ResolveReference(ref).String(), gojsonschema.NewStringLoader(referencedSchema)); err != nil {
+			return nil, errors.WithMessagef(err, "cannot load referenced schema %s", name)
+		}
+	}
+	if err = loader.AddSchema(jsonSchemaBaseURL, gojsonschema.NewStringLoader(schema)); err != nil {
+		return nil, err
+	}
+	compiled, err := loader.Compile(gojsonschema.NewReferenceLoader(jsonSchemaBaseURL))
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchemaSerializer{schemaID: schemaID, schema: compiled}, nil
+}
+
+func (s *JSONSchemaSerializer) Serialize(value interface{}) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid() {
+		violations := make([]string, 0, len(result.Errors()))
+		for _, violation := range result.Errors() {
+			violations = append(violations, violation.String())
+		}
+		return nil, errors.Errorf("json schema: invalid value: %s", strings.Join(violations, "; "))
+	}
+
+	binaryMsg := make([]byte, 0, len(payload)+9)
+	binaryMsg = appendSchemaID(binaryMsg, s.WireFormat, s.schemaID)
+	return append(binaryMsg, payload...), nil
+}
+
+// JSONSchemaDeserializer decodes the Confluent JSON Schema wire format into the given value
+type JSONSchemaDeserializer struct {
+	WireFormat WireFormat
+}
+
+func (d *JSONSchemaDeserializer) Deserialize(data []byte, v interface{}) error {
+	_, payload, err := readSchemaID(data, d.WireFormat)
+	if err != nil {
+		return err
+	}
+	if ptr, ok := v.(*interface{}); ok && *ptr != nil {
+		target := reflect.ValueOf(*ptr)
+		if target.Kind() != reflect.Ptr {
+			// decode into a new value of the type returned by the ValueFactory
+			decoded := reflect.New(target.Type())
+			if err = json.Unmarshal(payload, decoded.Interface()); err != nil {
+				return err
+			}
+			*ptr = decoded.Elem().Interface()
+			return nil
+		}
+		v = *ptr
+	}
+	return json.Unmarshal(payload, v)
+}
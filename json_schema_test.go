@@ -0,0 +1,118 @@
+package kafkaavro_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/registryserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const orderJSONSchema = `{
+  "type": "object",
+  "properties": {
+    "id": {"type": "string"},
+    "amount": {"type": "integer", "minimum": 0}
+  },
+  "required": ["id"]
+}`
+
+type jsonOrder struct {
+	ID     string `json:"id,omitempty"`
+	Amount int    `json:"amount"`
+}
+
+func TestProducer_JSONSchemaRoundTrip(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	srClient := &mockSchemaOfTypeClient{}
+	srClient.On("RegisterNewSchemaOfType", "topic-value", kafkaavro.SchemaTypeJSON, orderJSONSchema, []kafkaavro.SchemaReference(nil)).Return(9, nil)
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithJSONValueSchema(orderJSONSchema),
+	)
+	require.NoError(t, err)
+	srClient.AssertExpectations(t)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", jsonOrder{ID: "order-1", Amount: 10}, nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, append([]byte{0, 0, 0, 0, 9}, `{"id":"order-1","amount":10}`...), msg.Value)
+
+	err = p.Produce("key", jsonOrder{Amount: -1}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "json schema: invalid value")
+	assert.Len(t, kp.Calls, 1)
+
+	for name, factory := range map[string]kafkaavro.ValueFactory{
+		"value":   func(topic string) interface{} { return jsonOrder{} },
+		"pointer": func(topic string) interface{} { return &jsonOrder{} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			kc := &mockKafkaConsumer{}
+			c, err := kafkaavro.NewConsumer(
+				nil,
+				factory,
+				kafkaavro.WithKafkaConsumer(kc),
+				kafkaavro.WithSchemaRegistryClient(srClient),
+				kafkaavro.WithJSONDeserializer(),
+			)
+			require.NoError(t, err)
+
+			topic := "topic"
+			kc.On("Poll", 100).Return(&kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic},
+				Value:          msg.Value,
+			})
+			consumed, err := c.FetchMessage(100)
+			require.NoError(t, err)
+			switch v := consumed.Value.(type) {
+			case jsonOrder:
+				assert.Equal(t, jsonOrder{ID: "order-1", Amount: 10}, v)
+			case *jsonOrder:
+				assert.Equal(t, &jsonOrder{ID: "order-1", Amount: 10}, v)
+			default:
+				t.Errorf("unexpected value type %T", v)
+			}
+		})
+	}
+}
+
+func TestProducer_JSONSchemaReferences(t *testing.T) {
+	const moneyJSONSchema = `{"type": "object", "properties": {"amount": {"type": "integer", "minimum": 0}}, "required": ["amount"]}`
+	const paymentJSONSchema = `{"type": "object", "properties": {"total": {"$ref": "money.json"}}, "required": ["total"]}`
+
+	server := httptest.NewServer(registryserver.New())
+	defer server.Close()
+	srClient, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	require.NoError(t, err)
+	_, err = srClient.RegisterNewSchemaOfType("money-value", kafkaavro.SchemaTypeJSON, moneyJSONSchema, nil)
+	require.NoError(t, err)
+
+	kp := &mockKafkaProducer{}
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithJSONValueSchema(paymentJSONSchema, kafkaavro.SchemaReference{Name: "money.json", Subject: "money-value", Version: 1}),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", map[string]interface{}{"total": map[string]interface{}{"amount": 5}}, nil))
+	// the referenced schema applies to the value
+	err = p.Produce("key", map[string]interface{}{"total": map[string]interface{}{"amount": -5}}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "total.amount")
+}
@@ -0,0 +1,190 @@
+// Package kafkaavroprom exposes kafkaavro producer, consumer and schema registry client metrics to Prometheus
+package kafkaavroprom
+
+import (
+	"time"
+
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kafkaavro"
+
+// Metrics implements kafkaavro.Metrics with Prometheus counters and histograms,
+// it is a prometheus.Collector to register with a registry:
+//
+//	metrics := kafkaavroprom.NewMetrics()
+//	prometheus.MustRegister(metrics)
+type Metrics struct {
+	messagesProduced    *prometheus.CounterVec
+	messagesConsumed    *prometheus.CounterVec
+	encodeDuration      *prometheus.HistogramVec
+	encodeErrors        *prometheus.CounterVec
+	decodeDuration      *prometheus.HistogramVec
+	decodeErrors        *prometheus.CounterVec
+	deliveryFailures    *prometheus.CounterVec
+	commitFailures      *prometheus.CounterVec
+	produceRetries      *prometheus.CounterVec
+	schemaCacheHits     *prometheus.CounterVec
+	schemaCacheMisses   *prometheus.CounterVec
+	schemaFetchDuration *prometheus.HistogramVec
+	schemaFetchErrors   *prometheus.CounterVec
+	collectors          []prometheus.Collector
+}
+
+var _ kafkaavro.Metrics = (*Metrics)(nil)
+
+// NewMetrics returns unregistered metrics, encode and decode durations use
+// sub-millisecond buckets while schema registry requests use the default buckets
+func NewMetrics() *Metrics {
+	codecBuckets := prometheus.ExponentialBuckets(0.00001, 4, 10)
+	m := &Metrics{
+		messagesProduced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_produced_total",
+			Help:      "Messages produced.",
+		}, []string{"topic"}),
+		messagesConsumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_consumed_total",
+			Help:      "Messages consumed, including messages that could not be decoded.",
+		}, []string{"topic"}),
+		encodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "encode_duration_seconds",
+			Help:      "Time spent serializing message keys and values.",
+			Buckets:   codecBuckets,
+		}, []string{"topic"}),
+		encodeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "encode_errors_total",
+			Help:      "Messages that could not be serialized.",
+		}, []string{"topic"}),
+		decodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "decode_duration_seconds",
+			Help:      "Time spent deserializing message values.",
+			Buckets:   codecBuckets,
+		}, []string{"topic"}),
+		decodeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decode_errors_total",
+			Help:      "Messages that could not be deserialized.",
+		}, []string{"topic"}),
+		deliveryFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "delivery_failures_total",
+			Help:      "Messages rejected by the kafka producer or failing delivery.",
+		}, []string{"topic"}),
+		commitFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commit_failures_total",
+			Help:      "Failed offset commits.",
+		}, []string{"topic"}),
+		produceRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "produce_retries_total",
+			Help:      "Produce attempts retried by the producer backoff.",
+		}, []string{"topic"}),
+		schemaCacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schema_cache_hits_total",
+			Help:      "Schema lookups served from the schema cache.",
+		}, []string{"cache"}),
+		schemaCacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schema_cache_misses_total",
+			Help:      "Schema lookups that went to the schema registry.",
+		}, []string{"cache"}),
+		schemaFetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "schema_fetch_duration_seconds",
+			Help:      "Duration of schema registry requests made on schema cache misses.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"cache"}),
+		schemaFetchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schema_fetch_errors_total",
+			Help:      "Failed schema registry requests made on schema cache misses.",
+		}, []string{"cache"}),
+	}
+	m.collectors = []prometheus.Collector{
+		m.messagesProduced,
+		m.messagesConsumed,
+		m.encodeDuration,
+		m.encodeErrors,
+		m.decodeDuration,
+		m.decodeErrors,
+		m.deliveryFailures,
+		m.commitFailures,
+		m.produceRetries,
+		m.schemaCacheHits,
+		m.schemaCacheMisses,
+		m.schemaFetchDuration,
+		m.schemaFetchErrors,
+	}
+	return m
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) MessageProduced(topic string) {
+	m.messagesProduced.WithLabelValues(topic).Inc()
+}
+
+func (m *Metrics) MessageConsumed(topic string) {
+	m.messagesConsumed.WithLabelValues(topic).Inc()
+}
+
+func (m *Metrics) Encoded(topic string, duration time.Duration, err error) {
+	m.encodeDuration.WithLabelValues(topic).Observe(duration.Seconds())
+	if err != nil {
+		m.encodeErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+func (m *Metrics) Decoded(topic string, duration time.Duration, err error) {
+	m.decodeDuration.WithLabelValues(topic).Observe(duration.Seconds())
+	if err != nil {
+		m.decodeErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+func (m *Metrics) DeliveryFailed(topic string) {
+	m.deliveryFailures.WithLabelValues(topic).Inc()
+}
+
+func (m *Metrics) CommitFailed(topic string) {
+	m.commitFailures.WithLabelValues(topic).Inc()
+}
+
+func (m *Metrics) ProduceRetried(topic string) {
+	m.produceRetries.WithLabelValues(topic).Inc()
+}
+
+func (m *Metrics) SchemaCacheHit(cache string) {
+	m.schemaCacheHits.WithLabelValues(cache).Inc()
+}
+
+func (m *Metrics) SchemaCacheMiss(cache string) {
+	m.schemaCacheMisses.WithLabelValues(cache).Inc()
+}
+
+func (m *Metrics) SchemaFetched(cache string, duration time.Duration, err error) {
+	m.schemaFetchDuration.WithLabelValues(cache).Observe(duration.Seconds())
+	if err != nil {
+		m.schemaFetchErrors.WithLabelValues(cache).Inc()
+	}
+}
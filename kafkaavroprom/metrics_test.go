@@ -0,0 +1,87 @@
+package kafkaavroprom_test
+
+import (
+	"strings"
+	"testing"
+
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavroprom"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := kafkaavroprom.NewMetrics()
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(metrics))
+
+	broker := kafkaavrotest.NewBroker()
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	p, err := kafkaavro.NewProducer(
+		"users",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithMetrics(metrics),
+	)
+	require.NoError(t, err)
+	require.NoError(t, p.Produce("jane", "jane", nil))
+	require.Error(t, p.Produce("jane", 1, nil))
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"users"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithMetrics(metrics),
+	)
+	require.NoError(t, err)
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+
+	expected := `
+# HELP kafkaavro_encode_errors_total Messages that could not be serialized.
+# TYPE kafkaavro_encode_errors_total counter
+kafkaavro_encode_errors_total{topic="users"} 1
+# HELP kafkaavro_messages_consumed_total Messages consumed, including messages that could not be decoded.
+# TYPE kafkaavro_messages_consumed_total counter
+kafkaavro_messages_consumed_total{topic="users"} 1
+# HELP kafkaavro_messages_produced_total Messages produced.
+# TYPE kafkaavro_messages_produced_total counter
+kafkaavro_messages_produced_total{topic="users"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"kafkaavro_encode_errors_total",
+		"kafkaavro_messages_consumed_total",
+		"kafkaavro_messages_produced_total",
+	))
+	// one series per topic for each of the encode and decode histograms
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics, "kafkaavro_encode_duration_seconds", "kafkaavro_decode_duration_seconds"))
+}
+
+func TestMetrics_SchemaCache(t *testing.T) {
+	metrics := kafkaavroprom.NewMetrics()
+	metrics.SchemaCacheMiss(kafkaavro.SchemaCacheID)
+	metrics.SchemaCacheHit(kafkaavro.SchemaCacheID)
+	metrics.SchemaCacheHit(kafkaavro.SchemaCacheID)
+
+	expected := `
+# HELP kafkaavro_schema_cache_hits_total Schema lookups served from the schema cache.
+# TYPE kafkaavro_schema_cache_hits_total counter
+kafkaavro_schema_cache_hits_total{cache="id"} 2
+# HELP kafkaavro_schema_cache_misses_total Schema lookups that went to the schema registry.
+# TYPE kafkaavro_schema_cache_misses_total counter
+kafkaavro_schema_cache_misses_total{cache="id"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(metrics, strings.NewReader(expected),
+		"kafkaavro_schema_cache_hits_total",
+		"kafkaavro_schema_cache_misses_total",
+	))
+}
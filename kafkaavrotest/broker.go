@@ -0,0 +1,566 @@
+package kafkaavrotest
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Broker is an in-process kafka broker for tests. Producers and consumers created
+// from the same broker share its topics, partitions and consumer group offsets,
+// so messages produced by one side are consumed by the other.
+// Producing to an unknown topic creates it with a single partition.
+type Broker struct {
+	mu sync.Mutex
+
+	topics map[string][][]*kafka.Message // map[topic]partitions
+	groups map[string]*consumerGroup
+	// produced is closed and replaced whenever messages are produced to wake up polling consumers
+	produced chan struct{}
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type consumerGroup struct {
+	committed map[topicPartition]kafka.Offset
+	members   []*KafkaConsumer
+	// generation is incremented on every membership or topic change, members compare it
+	// to the generation of their assignment to detect rebalances
+	generation int
+}
+
+// NewBroker returns a broker without topics
+func NewBroker() *Broker {
+	return &Broker{
+		topics:   make(map[string][][]*kafka.Message),
+		groups:   make(map[string]*consumerGroup),
+		produced: make(chan struct{}),
+	}
+}
+
+// CreateTopic creates the topic with the number of partitions, existing topics are left unchanged.
+// It panics when partitions is less than 1.
+func (b *Broker) CreateTopic(topic string, partitions int) {
+	if partitions < 1 {
+		panic(fmt.Sprintf("kafkaavrotest: topic %s must have at least one partition, got %d", topic, partitions))
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.createTopic(topic, partitions)
+}
+
+// Messages returns the messages of all partitions of the topic, ordered by partition and offset
+func (b *Broker) Messages(topic string) []*kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var messages []*kafka.Message
+	for _, partition := range b.topics[topic] {
+		for _, msg := range partition {
+			messages = append(messages, copyMessage(msg))
+		}
+	}
+	return messages
+}
+
+// CommittedOffset returns the offset committed by the consumer group for the partition,
+// kafka.OffsetInvalid when nothing was committed
+func (b *Broker) CommittedOffset(groupID string, topic string, partition int32) kafka.Offset {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if group, ok := b.groups[groupID]; ok {
+		if offset, ok := group.committed[topicPartition{topic: topic, partition: partition}]; ok {
+			return offset
+		}
+	}
+	return kafka.OffsetInvalid
+}
+
+// NewKafkaProducer returns a producer writing to the broker
+func (b *Broker) NewKafkaProducer() *KafkaProducer {
+	return &KafkaProducer{broker: b}
+}
+
+// NewKafkaConsumer returns a consumer of the group, consumers of the same group share
+// the partitions of the topics they subscribe to. Consumers without committed offsets
+// start from the earliest message.
+func (b *Broker) NewKafkaConsumer(groupID string) *KafkaConsumer {
+	return &KafkaConsumer{broker: b, groupID: groupID, generation: -1}
+}
+
+func (b *Broker) createTopic(topic string, partitions int) {
+	if _, ok := b.topics[topic]; ok {
+		return
+	}
+	b.topics[topic] = make([][]*kafka.Message, partitions)
+	for _, group := range b.groups {
+		group.generation++
+	}
+}
+
+func (b *Broker) group(groupID string) *consumerGroup {
+	group, ok := b.groups[groupID]
+	if !ok {
+		group = &consumerGroup{committed: make(map[topicPartition]kafka.Offset)}
+		b.groups[groupID] = group
+	}
+	return group
+}
+
+func (b *Broker) metadata(topic *string, allTopics bool) *kafka.Metadata {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	broker := kafka.BrokerMetadata{ID: 1, Host: "localhost", Port: 9092}
+	meta := &kafka.Metadata{
+		Brokers:           []kafka.BrokerMetadata{broker},
+		Topics:            make(map[string]kafka.TopicMetadata),
+		OriginatingBroker: broker,
+	}
+	for name, partitions := range b.topics {
+		if topic != nil && *topic != name {
+			continue
+		}
+		if topic == nil && !allTopics {
+			continue
+		}
+		topicMeta := kafka.TopicMetadata{Topic: name}
+		for i := range partitions {
+			topicMeta.Partitions = append(topicMeta.Partitions, kafka.PartitionMetadata{
+				ID:       int32(i),
+				Leader:   broker.ID,
+				Replicas: []int32{broker.ID},
+				Isrs:     []int32{broker.ID},
+			})
+		}
+		meta.Topics[name] = topicMeta
+	}
+	return meta
+}
+
+func (b *Broker) watermarks(topic string, partition int32) (int64, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	partitions, ok := b.topics[topic]
+	if !ok || partition < 0 || int(partition) >= len(partitions) {
+		return 0, 0, kafka.NewError(kafka.ErrUnknownTopicOrPart, "unknown topic or partition", false)
+	}
+	return 0, int64(len(partitions[partition])), nil
+}
+
+// offsetsForTimes returns the earliest offset whose timestamp is at or after the timestamp
+// given as offset, kafka.OffsetEnd when there is none
+func (b *Broker) offsetsForTimes(times []kafka.TopicPartition) []kafka.TopicPartition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	offsets := make([]kafka.TopicPartition, 0, len(times))
+	for _, tp := range times {
+		result := tp
+		result.Offset = kafka.OffsetEnd
+		partitions, ok := b.topics[*tp.Topic]
+		if !ok || tp.Partition < 0 || int(tp.Partition) >= len(partitions) {
+			result.Error = kafka.NewError(kafka.ErrUnknownTopicOrPart, "unknown topic or partition", false)
+			offsets = append(offsets, result)
+			continue
+		}
+		for _, msg := range partitions[tp.Partition] {
+			if msg.Timestamp.UnixNano()/int64(time.Millisecond) >= int64(tp.Offset) {
+				result.Offset = msg.TopicPartition.Offset
+				break
+			}
+		}
+		offsets = append(offsets, result)
+	}
+	return offsets
+}
+
+// KafkaProducer produces messages to a Broker, it implements kafkaavro.KafkaProducer
+type KafkaProducer struct {
+	broker *Broker
+}
+
+func (p *KafkaProducer) Close() {}
+
+func (p *KafkaProducer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	return p.broker.metadata(topic, allTopics), nil
+}
+
+func (p *KafkaProducer) OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error) {
+	return p.broker.offsetsForTimes(times), nil
+}
+
+// Produce appends the message to its partition, messages produced to kafka.PartitionAny
+// are partitioned by key hash or spread over partitions when they have no key.
+// The delivery report is sent asynchronously to deliveryChan when it is not nil.
+func (p *KafkaProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	if msg.TopicPartition.Topic == nil {
+		return kafka.NewError(kafka.ErrUnknownTopicOrPart, "missing topic", false)
+	}
+	b := p.broker
+	b.mu.Lock()
+	topic := *msg.TopicPartition.Topic
+	b.createTopic(topic, 1)
+	partitions := b.topics[topic]
+
+	partition := msg.TopicPartition.Partition
+	if partition == kafka.PartitionAny {
+		partition = choosePartition(msg.Key, len(partitions), b.totalMessages(topic))
+	}
+	if partition < 0 || int(partition) >= len(partitions) {
+		b.mu.Unlock()
+		return kafka.NewError(kafka.ErrUnknownPartition, "unknown partition", false)
+	}
+
+	stored := copyMessage(msg)
+	stored.TopicPartition = kafka.TopicPartition{
+		Topic:     &topic,
+		Partition: partition,
+		Offset:    kafka.Offset(len(partitions[partition])),
+	}
+	if stored.Timestamp.IsZero() {
+		stored.Timestamp = time.Now()
+		stored.TimestampType = kafka.TimestampCreateTime
+	}
+	partitions[partition] = append(partitions[partition], stored)
+	close(b.produced)
+	b.produced = make(chan struct{})
+	b.mu.Unlock()
+
+	if deliveryChan != nil {
+		report := copyMessage(stored)
+		report.Opaque = msg.Opaque
+		go func() {
+			deliveryChan <- report
+		}()
+	}
+	return nil
+}
+
+func (p *KafkaProducer) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error) {
+	return p.broker.watermarks(topic, partition)
+}
+
+func (b *Broker) totalMessages(topic string) int {
+	total := 0
+	for _, partition := range b.topics[topic] {
+		total += len(partition)
+	}
+	return total
+}
+
+func choosePartition(key []byte, partitions int, sequence int) int32 {
+	if len(key) == 0 {
+		return int32(sequence % partitions)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int32(h.Sum32() % uint32(partitions))
+}
+
+// KafkaConsumer consumes messages from a Broker as a member of a consumer group,
+// it implements kafkaavro.KafkaConsumer
+type KafkaConsumer struct {
+	broker  *Broker
+	groupID string
+
+	// the fields below are guarded by the broker lock
+	topics     []string
+	generation int
+	assignment []topicPartition
+	positions  map[topicPartition]kafka.Offset
+	next       int
+	// manual is set when partitions were assigned with Assign rather than by the group
+	manual bool
+}
+
+// Close leaves the consumer group, its partitions are assigned to the remaining members
+func (c *KafkaConsumer) Close() error {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.leave()
+	return nil
+}
+
+// CommitMessage commits the offset following the message for the consumer group
+func (c *KafkaConsumer) CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error) {
+	if m.TopicPartition.Topic == nil {
+		return nil, kafka.NewError(kafka.ErrUnknownTopicOrPart, "missing topic", false)
+	}
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	offset := m.TopicPartition.Offset + 1
+	b.group(c.groupID).committed[topicPartition{topic: *m.TopicPartition.Topic, partition: m.TopicPartition.Partition}] = offset
+	return []kafka.TopicPartition{{Topic: m.TopicPartition.Topic, Partition: m.TopicPartition.Partition, Offset: offset}}, nil
+}
+
+// SubscribeTopics joins the consumer group, replacing the current subscription.
+// The rebalance callback is not invoked.
+func (c *KafkaConsumer) SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) (err error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.leave()
+	c.manual = false
+	c.topics = append([]string(nil), topics...)
+	group := b.group(c.groupID)
+	group.members = append(group.members, c)
+	group.generation++
+	return nil
+}
+
+// Poll returns the next message of the assigned partitions, waiting up to timeoutMs
+// for one to be produced. A negative timeout waits indefinitely.
+func (c *KafkaConsumer) Poll(timeoutMs int) kafka.Event {
+	var timeout <-chan time.Time
+	if timeoutMs >= 0 {
+		timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	b := c.broker
+	for {
+		b.mu.Lock()
+		msg := c.nextMessage()
+		produced := b.produced
+		b.mu.Unlock()
+		if msg != nil {
+			return msg
+		}
+		select {
+		case <-produced:
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
+func (c *KafkaConsumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	return c.broker.metadata(topic, allTopics), nil
+}
+
+// Assign leaves the consumer group and consumes the partitions from their offsets,
+// logical offsets resume from the committed offset of the group or the first message
+func (c *KafkaConsumer) Assign(partitions []kafka.TopicPartition) (err error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.leave()
+	c.manual = true
+	c.assignment = make([]topicPartition, 0, len(partitions))
+	c.positions = make(map[topicPartition]kafka.Offset, len(partitions))
+	c.next = 0
+	group := b.group(c.groupID)
+	for _, partition := range partitions {
+		if partition.Topic == nil {
+			return kafka.NewError(kafka.ErrUnknownTopicOrPart, "missing topic", false)
+		}
+		tp := topicPartition{topic: *partition.Topic, partition: partition.Partition}
+		if partitions, ok := b.topics[tp.topic]; !ok || tp.partition < 0 || int(tp.partition) >= len(partitions) {
+			return kafka.NewError(kafka.ErrUnknownTopicOrPart, "unknown topic or partition", false)
+		}
+		offset := partition.Offset
+		switch {
+		case offset == kafka.OffsetEnd:
+			offset = kafka.Offset(len(b.topics[tp.topic][tp.partition]))
+		case offset < 0:
+			offset = 0
+			if committed, ok := group.committed[tp]; ok && partition.Offset != kafka.OffsetBeginning {
+				offset = committed
+			}
+		}
+		c.assignment = append(c.assignment, tp)
+		c.positions[tp] = offset
+	}
+	return nil
+}
+
+// Assignment returns the partitions assigned to the consumer by its group
+func (c *KafkaConsumer) Assignment() (partitions []kafka.TopicPartition, err error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.rebalance()
+	partitions = make([]kafka.TopicPartition, 0, len(c.assignment))
+	for _, tp := range c.assignment {
+		topic := tp.topic
+		partitions = append(partitions, kafka.TopicPartition{Topic: &topic, Partition: tp.partition, Offset: kafka.OffsetInvalid})
+	}
+	return partitions, nil
+}
+
+// Committed returns the offsets committed by the consumer group, kafka.OffsetInvalid for partitions without commits
+func (c *KafkaConsumer) Committed(partitions []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	group := b.group(c.groupID)
+	offsets = make([]kafka.TopicPartition, 0, len(partitions))
+	for _, tp := range partitions {
+		tp.Offset = kafka.OffsetInvalid
+		if committed, ok := group.committed[topicPartition{topic: *tp.Topic, partition: tp.Partition}]; ok {
+			tp.Offset = committed
+		}
+		offsets = append(offsets, tp)
+	}
+	return offsets, nil
+}
+
+// Position returns the offsets of the next messages to be consumed from the assigned partitions,
+// kafka.OffsetInvalid for partitions which are not assigned
+func (c *KafkaConsumer) Position(partitions []kafka.TopicPartition) (offsets []kafka.TopicPartition, err error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	offsets = make([]kafka.TopicPartition, 0, len(partitions))
+	for _, tp := range partitions {
+		tp.Offset = kafka.OffsetInvalid
+		if position, ok := c.positions[topicPartition{topic: *tp.Topic, partition: tp.Partition}]; ok {
+			tp.Offset = position
+		}
+		offsets = append(offsets, tp)
+	}
+	return offsets, nil
+}
+
+func (c *KafkaConsumer) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error) {
+	return c.broker.watermarks(topic, partition)
+}
+
+func (c *KafkaConsumer) OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error) {
+	return c.broker.offsetsForTimes(times), nil
+}
+
+// Seek moves the assigned partition to the offset, kafka.OffsetBeginning and kafka.OffsetEnd
+// move it to the first message and past the last message
+func (c *KafkaConsumer) Seek(partition kafka.TopicPartition, timeoutMs int) error {
+	if partition.Topic == nil {
+		return kafka.NewError(kafka.ErrUnknownTopicOrPart, "missing topic", false)
+	}
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.rebalance()
+	tp := topicPartition{topic: *partition.Topic, partition: partition.Partition}
+	if _, ok := c.positions[tp]; !ok {
+		return kafka.NewError(kafka.ErrUnknownPartition, "partition not assigned", false)
+	}
+	offset := partition.Offset
+	switch offset {
+	case kafka.OffsetBeginning:
+		offset = 0
+	case kafka.OffsetEnd:
+		offset = kafka.Offset(len(b.topics[tp.topic][tp.partition]))
+	}
+	if offset < 0 {
+		return kafka.NewError(kafka.ErrInvalidArg, "invalid offset", false)
+	}
+	c.positions[tp] = offset
+	return nil
+}
+
+// leave removes the consumer from its group
+func (c *KafkaConsumer) leave() {
+	group, ok := c.broker.groups[c.groupID]
+	if !ok {
+		return
+	}
+	for i, member := range group.members {
+		if member == c {
+			group.members = append(group.members[:i], group.members[i+1:]...)
+			group.generation++
+			break
+		}
+	}
+	c.topics = nil
+	c.assignment = nil
+	c.positions = nil
+}
+
+// nextMessage returns the next message of the assignment, visiting partitions in turn
+func (c *KafkaConsumer) nextMessage() *kafka.Message {
+	c.rebalance()
+	for i := 0; i < len(c.assignment); i++ {
+		tp := c.assignment[(c.next+i)%len(c.assignment)]
+		partition := c.broker.topics[tp.topic][tp.partition]
+		position := c.positions[tp]
+		if int(position) >= len(partition) {
+			continue
+		}
+		c.positions[tp] = position + 1
+		c.next = (c.next + i + 1) % len(c.assignment)
+		return copyMessage(partition[position])
+	}
+	return nil
+}
+
+// rebalance recomputes the assignment when the group changed since it was last computed.
+// Partitions of each topic are spread over the members subscribed to it, newly assigned
+// partitions resume from the committed offset of the group.
+func (c *KafkaConsumer) rebalance() {
+	if c.manual {
+		return
+	}
+	group := c.broker.group(c.groupID)
+	if c.generation == group.generation {
+		return
+	}
+	c.generation = group.generation
+
+	var assignment []topicPartition
+	positions := make(map[topicPartition]kafka.Offset)
+	for _, topic := range c.topics {
+		var subscribed []*KafkaConsumer
+		for _, member := range group.members {
+			if containsTopic(member.topics, topic) {
+				subscribed = append(subscribed, member)
+			}
+		}
+		for i := range c.broker.topics[topic] {
+			if subscribed[i%len(subscribed)] != c {
+				continue
+			}
+			tp := topicPartition{topic: topic, partition: int32(i)}
+			assignment = append(assignment, tp)
+			if position, ok := c.positions[tp]; ok {
+				positions[tp] = position
+			} else if committed, ok := group.committed[tp]; ok {
+				positions[tp] = committed
+			} else {
+				positions[tp] = 0
+			}
+		}
+	}
+	sort.Slice(assignment, func(i, j int) bool {
+		if assignment[i].topic != assignment[j].topic {
+			return assignment[i].topic < assignment[j].topic
+		}
+		return assignment[i].partition < assignment[j].partition
+	})
+	c.assignment = assignment
+	c.positions = positions
+	c.next = 0
+}
+
+func containsTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func copyMessage(msg *kafka.Message) *kafka.Message {
+	copied := *msg
+	copied.Key = append([]byte(nil), msg.Key...)
+	copied.Value = append([]byte(nil), msg.Value...)
+	copied.Headers = append([]kafka.Header(nil), msg.Headers...)
+	return &copied
+}
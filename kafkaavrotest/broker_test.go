@@ -0,0 +1,175 @@
+package kafkaavrotest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func produceRaw(t *testing.T, p *kafkaavrotest.KafkaProducer, topic string, key string, value string) *kafka.Message {
+	deliveryChan := make(chan kafka.Event)
+	require.NoError(t, p.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            []byte(key),
+		Value:          []byte(value),
+	}, deliveryChan))
+	return (<-deliveryChan).(*kafka.Message)
+}
+
+func TestBroker_RoundTrip(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+
+	p, err := kafkaavro.NewProducer(
+		"users",
+		`"string"`,
+		userV1,
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+	)
+	require.NoError(t, err)
+	require.NoError(t, p.Produce("jane", map[string]interface{}{"name": "jane"}, nil))
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"users"},
+		func(topic string) interface{} {
+			return map[string]interface{}{}
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+	)
+	require.NoError(t, err)
+
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	assert.Equal(t, map[string]interface{}{"name": "jane"}, msg.Value)
+
+	_, err = c.CommitMessage(msg.Message)
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Offset(1), broker.CommittedOffset("group", "users", 0))
+
+	msg, err = c.FetchMessage(10)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+}
+
+func TestBroker_ConsumerGroups(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 2)
+	p := broker.NewKafkaProducer()
+
+	first := broker.NewKafkaConsumer("group")
+	second := broker.NewKafkaConsumer("group")
+	other := broker.NewKafkaConsumer("other")
+	for _, c := range []*kafkaavrotest.KafkaConsumer{first, second, other} {
+		require.NoError(t, c.SubscribeTopics([]string{"topic"}, nil))
+	}
+
+	// keyless messages are spread over both partitions
+	for _, value := range []string{"a", "b", "c", "d"} {
+		produceRaw(t, p, "topic", "", value)
+	}
+
+	// each member of the group consumes one partition
+	partitions := map[int32][]string{}
+	for _, c := range []*kafkaavrotest.KafkaConsumer{first, second} {
+		for i := 0; i < 2; i++ {
+			msg := c.Poll(100).(*kafka.Message)
+			partitions[msg.TopicPartition.Partition] = append(partitions[msg.TopicPartition.Partition], string(msg.Value))
+		}
+		assert.Nil(t, c.Poll(10))
+	}
+	assert.Equal(t, map[int32][]string{0: {"a", "c"}, 1: {"b", "d"}}, partitions)
+
+	// another group consumes every message
+	for i := 0; i < 4; i++ {
+		assert.NotNil(t, other.Poll(100))
+	}
+	assert.Nil(t, other.Poll(10))
+}
+
+func TestBroker_Rebalance(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 2)
+	p := broker.NewKafkaProducer()
+
+	first := broker.NewKafkaConsumer("group")
+	second := broker.NewKafkaConsumer("group")
+	require.NoError(t, first.SubscribeTopics([]string{"topic"}, nil))
+	require.NoError(t, second.SubscribeTopics([]string{"topic"}, nil))
+
+	produceRaw(t, p, "topic", "", "a")
+	produceRaw(t, p, "topic", "", "b")
+
+	msg := second.Poll(100).(*kafka.Message)
+	_, err := second.CommitMessage(msg)
+	require.NoError(t, err)
+	require.NoError(t, second.Close())
+
+	// the remaining member takes over the partition from its committed offset
+	msg = first.Poll(100).(*kafka.Message)
+	assert.Equal(t, "a", string(msg.Value))
+	assert.Nil(t, first.Poll(10))
+}
+
+func TestBroker_PollWaitsForMessages(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	c := broker.NewKafkaConsumer("group")
+	require.NoError(t, c.SubscribeTopics([]string{"topic"}, nil))
+
+	topic := "topic"
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, broker.NewKafkaProducer().Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+			Value:          []byte("value"),
+		}, nil))
+	}()
+
+	msg, ok := c.Poll(1000).(*kafka.Message)
+	require.True(t, ok)
+	assert.Equal(t, "value", string(msg.Value))
+}
+
+func TestBroker_Offsets(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	p := broker.NewKafkaProducer()
+
+	topic := "topic"
+	start := time.Now()
+	for _, value := range []string{"a", "b"} {
+		require.NoError(t, p.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0},
+			Value:          []byte(value),
+			Timestamp:      start.Add(time.Duration(len(broker.Messages(topic))) * time.Hour),
+		}, nil))
+	}
+
+	low, high, err := p.QueryWatermarkOffsets(topic, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), low)
+	assert.Equal(t, int64(2), high)
+
+	offsets, err := p.OffsetsForTimes([]kafka.TopicPartition{
+		{Topic: &topic, Partition: 0, Offset: kafka.Offset(start.Add(time.Minute).UnixNano() / int64(time.Millisecond))},
+	}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, kafka.Offset(1), offsets[0].Offset)
+
+	meta, err := p.GetMetadata(nil, true, 100)
+	require.NoError(t, err)
+	assert.Len(t, meta.Topics[topic].Partitions, 1)
+}
+
+func TestBroker_CreateTopicWithoutPartitions(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	assert.PanicsWithValue(t, "kafkaavrotest: topic topic must have at least one partition, got 0", func() {
+		broker.CreateTopic("topic", 0)
+	})
+}
@@ -0,0 +1,214 @@
+// Package kafkaavrotest provides in-memory implementations of the kafkaavro dependencies for tests
+package kafkaavrotest
+
+import (
+	"github.com/hamba/avro"
+	schemaregistry "github.com/landoop/schema-registry"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/internal/registry"
+	"github.com/pkg/errors"
+)
+
+// Compatibility levels as named by the schema registry
+const (
+	CompatibilityNone               = registry.CompatibilityNone
+	CompatibilityBackward           = registry.CompatibilityBackward
+	CompatibilityBackwardTransitive = registry.CompatibilityBackwardTransitive
+	CompatibilityForward            = registry.CompatibilityForward
+	CompatibilityForwardTransitive  = registry.CompatibilityForwardTransitive
+	CompatibilityFull               = registry.CompatibilityFull
+	CompatibilityFullTransitive     = registry.CompatibilityFullTransitive
+)
+
+// SchemaRegistryClient is an in-memory schema registry implementing the schema registry
+// client used by producers and consumers. Like the schema registry it assigns one ID per
+// distinct schema across subjects, keeps the versions of each subject and checks the
+// compatibility of new avro schema versions, BACKWARD by default.
+type SchemaRegistryClient struct {
+	registry *registry.Registry
+}
+
+// NewSchemaRegistryClient returns an empty in-memory schema registry
+func NewSchemaRegistryClient() *SchemaRegistryClient {
+	return &SchemaRegistryClient{registry: registry.New()}
+}
+
+// SetCompatibility sets the global compatibility level
+func (c *SchemaRegistryClient) SetCompatibility(level string) error {
+	return c.registry.SetCompatibility("", level)
+}
+
+// SetSubjectCompatibility sets the compatibility level of the subject, overriding the global level
+func (c *SchemaRegistryClient) SetSubjectCompatibility(subject string, level string) error {
+	return c.registry.SetCompatibility(subject, level)
+}
+
+// GetSchemaByID returns the avro schema with the given id
+func (c *SchemaRegistryClient) GetSchemaByID(id int) (avro.Schema, error) {
+	schema, err := c.registry.SchemaByID(id)
+	if err != nil {
+		return nil, kafkaavro.ErrSchemaNotFound{SchemaID: id, Err: err}
+	}
+	return avroSchema(schema)
+}
+
+// RegisterNewSchema registers the avro schema to the subject and returns its id
+func (c *SchemaRegistryClient) RegisterNewSchema(subject string, schema avro.Schema) (int, error) {
+	id, err := c.registry.Register(subject, registry.Schema{Schema: schema.String(), Parsed: schema})
+	return id, clientError(err, subject)
+}
+
+// RegisterNewSchemaWithReferences registers the avro schema JSON along with the schemas it references
+func (c *SchemaRegistryClient) RegisterNewSchemaWithReferences(subject string, schemaJSON string, references []kafkaavro.SchemaReference) (int, error) {
+	return c.RegisterNewSchemaOfType(subject, kafkaavro.SchemaTypeAvro, schemaJSON, references)
+}
+
+// RegisterNewSchemaOfType registers a schema of any type to the subject and returns its id,
+// only avro schemas are parsed and checked for compatibility
+func (c *SchemaRegistryClient) RegisterNewSchemaOfType(subject string, schemaType string, schema string, references []kafkaavro.SchemaReference) (int, error) {
+	id, err := c.registry.Register(subject, registry.Schema{SchemaType: schemaType, Schema: schema, References: references})
+	return id, clientError(err, subject)
+}
+
+// GetReferencedSchemas returns the schemas the references point to, and those they reference in turn, by reference name
+func (c *SchemaRegistryClient) GetReferencedSchemas(references []kafkaavro.SchemaReference) (map[string]string, error) {
+	referenced := make(map[string]string, len(references))
+	if err := c.resolveReferences(references, referenced); err != nil {
+		return nil, err
+	}
+	return referenced, nil
+}
+
+func (c *SchemaRegistryClient) resolveReferences(references []kafkaavro.SchemaReference, referenced map[string]string) error {
+	for _, ref := range references {
+		if _, ok := referenced[ref.Name]; ok {
+			continue
+		}
+		version := ref.Version
+		if version <= 0 {
+			version = registry.LatestVersion
+		}
+		schema, err := c.registry.Version(ref.Subject, version)
+		if err != nil {
+			return clientError(err, ref.Subject)
+		}
+		referenced[ref.Name] = schema.Schema
+		if err = c.resolveReferences(schema.References, referenced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LookupSchemaOfType returns the id of an identical schema registered to the subject
+func (c *SchemaRegistryClient) LookupSchemaOfType(subject string, schemaType string, schema string, references []kafkaavro.SchemaReference) (int, error) {
+	registered, err := c.registry.Lookup(subject, registry.Schema{SchemaType: schemaType, Schema: schema, References: references})
+	if err == registry.ErrSubjectNotFound || err == registry.ErrSchemaNotFound {
+		return 0, kafkaavro.ErrSchemaNotRegistered{Subject: subject}
+	}
+	if err != nil {
+		return 0, clientError(err, subject)
+	}
+	return registered.ID, nil
+}
+
+// IsSchemaRegistered checks if the avro schema is registered to the subject
+func (c *SchemaRegistryClient) IsSchemaRegistered(subject string, schema avro.Schema) (bool, schemaregistry.Schema, error) {
+	registered, err := c.registry.Lookup(subject, registry.Schema{Schema: schema.String(), Parsed: schema})
+	if err == registry.ErrSchemaNotFound {
+		return false, schemaregistry.Schema{}, nil
+	}
+	if err != nil {
+		return false, schemaregistry.Schema{}, clientError(err, subject)
+	}
+	return true, schemaregistry.Schema{Schema: registered.Schema, Subject: subject, Version: registered.Version, ID: registered.ID}, nil
+}
+
+// GetSchemaBySubject returns the avro schema for a specific version of a subject
+func (c *SchemaRegistryClient) GetSchemaBySubject(subject string, version int) (avro.Schema, error) {
+	if version <= 0 {
+		return nil, kafkaavro.ErrSchemaNotFound{Subject: subject}
+	}
+	schema, err := c.registry.Version(subject, version)
+	if err != nil {
+		return nil, clientError(err, subject)
+	}
+	return avroSchema(schema)
+}
+
+// GetLatestSchema returns the highest version avro schema of a subject
+func (c *SchemaRegistryClient) GetLatestSchema(subject string) (avro.Schema, error) {
+	schema, err := c.registry.Version(subject, registry.LatestVersion)
+	if err != nil {
+		return nil, clientError(err, subject)
+	}
+	return avroSchema(schema)
+}
+
+// GetLatestSchemaWithID returns the highest version avro schema of a subject along with its id
+func (c *SchemaRegistryClient) GetLatestSchemaWithID(subject string) (int, avro.Schema, error) {
+	schema, err := c.registry.Version(subject, registry.LatestVersion)
+	if err != nil {
+		return 0, nil, clientError(err, subject)
+	}
+	parsed, err := avroSchema(schema)
+	if err != nil {
+		return 0, nil, err
+	}
+	return schema.ID, parsed, nil
+}
+
+// Subjects returns the sorted list of subjects
+func (c *SchemaRegistryClient) Subjects() ([]string, error) {
+	return c.registry.Subjects(), nil
+}
+
+// Versions returns the versions of a subject
+func (c *SchemaRegistryClient) Versions(subject string) ([]int, error) {
+	versions, err := c.registry.Versions(subject)
+	return versions, clientError(err, subject)
+}
+
+// DeleteSubject deletes the subject and returns the versions it had,
+// schemas remain available by id
+func (c *SchemaRegistryClient) DeleteSubject(subject string) ([]int, error) {
+	versions, err := c.registry.DeleteSubject(subject)
+	return versions, clientError(err, subject)
+}
+
+// DeleteSubjectVersion deletes a single version of a subject, the subject is
+// deleted along with its last version
+func (c *SchemaRegistryClient) DeleteSubjectVersion(subject string, version int) error {
+	if version <= 0 {
+		return kafkaavro.ErrSchemaNotFound{Subject: subject}
+	}
+	_, err := c.registry.DeleteVersion(subject, version)
+	return clientError(err, subject)
+}
+
+// CheckCompatibility reports whether the avro schema could be registered as a new version of the subject
+func (c *SchemaRegistryClient) CheckCompatibility(subject string, schema avro.Schema) error {
+	err := c.registry.CheckCompatibility(subject, registry.LatestVersion, registry.Schema{Schema: schema.String(), Parsed: schema})
+	if err == registry.ErrSubjectNotFound {
+		return nil
+	}
+	return clientError(err, subject)
+}
+
+func avroSchema(schema registry.Schema) (avro.Schema, error) {
+	if schema.Parsed == nil {
+		return nil, errors.Errorf("schema %d is a %s schema", schema.ID, schema.SchemaType)
+	}
+	return schema.Parsed, nil
+}
+
+// clientError reports registry errors as the errors of the schema registry client
+func clientError(err error, subject string) error {
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case registry.ErrSubjectNotFound, registry.ErrVersionNotFound, registry.ErrSchemaNotFound, registry.ErrReferencedSubjectNotFound:
+		return kafkaavro.ErrSchemaNotFound{Subject: subject, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package kafkaavrotest_test
+
+import (
+	"testing"
+
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userV1 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}]}`
+	userV2 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}, {"name": "age", "type": "int", "default": 0}]}`
+	// userV3 adds a field without a default, which readers of the new schema cannot fill from old data
+	userV3 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}, {"name": "email", "type": "string"}]}`
+)
+
+func TestSchemaRegistryClient_RegisterNewSchema(t *testing.T) {
+	client := kafkaavrotest.NewSchemaRegistryClient()
+
+	id1, err := client.RegisterNewSchema("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	id2, err := client.RegisterNewSchema("users-value", avro.MustParse(userV2))
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	again, err := client.RegisterNewSchema("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	assert.Equal(t, id1, again)
+
+	// the same schema shares its id across subjects
+	other, err := client.RegisterNewSchema("admins-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	assert.Equal(t, id1, other)
+
+	schema, err := client.GetSchemaByID(id2)
+	require.NoError(t, err)
+	assert.Equal(t, avro.MustParse(userV2).String(), schema.String())
+
+	versions, err := client.Versions("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	latest, err := client.GetLatestSchema("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, schema.String(), latest.String())
+
+	subjects, err := client.Subjects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admins-value", "users-value"}, subjects)
+
+	found, registered, err := client.IsSchemaRegistered("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 1, registered.Version)
+	assert.Equal(t, id1, registered.ID)
+
+	_, err = client.GetSchemaByID(42)
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+}
+
+func TestSchemaRegistryClient_Compatibility(t *testing.T) {
+	client := kafkaavrotest.NewSchemaRegistryClient()
+
+	_, err := client.RegisterNewSchema("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+
+	_, err = client.RegisterNewSchema("users-value", avro.MustParse(userV3))
+	assert.True(t, kafkaavro.IsErrSchemaIncompatible(err))
+	assert.Error(t, client.CheckCompatibility("users-value", avro.MustParse(userV3)))
+
+	// dropping a field is not forward compatible
+	client.SetSubjectCompatibility("users-value", kafkaavrotest.CompatibilityForward)
+	_, err = client.RegisterNewSchema("users-value", avro.MustParse(`{"type": "record", "name": "user", "fields": []}`))
+	assert.True(t, kafkaavro.IsErrSchemaIncompatible(err))
+
+	client.SetSubjectCompatibility("users-value", kafkaavrotest.CompatibilityNone)
+	_, err = client.RegisterNewSchema("users-value", avro.MustParse(userV3))
+	assert.NoError(t, err)
+}
+
+func TestSchemaRegistryClient_Delete(t *testing.T) {
+	client := kafkaavrotest.NewSchemaRegistryClient()
+
+	id, err := client.RegisterNewSchema("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	_, err = client.RegisterNewSchema("users-value", avro.MustParse(userV2))
+	require.NoError(t, err)
+
+	require.NoError(t, client.DeleteSubjectVersion("users-value", 2))
+	versions, err := client.Versions("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, versions)
+
+	versions, err = client.DeleteSubject("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, versions)
+
+	_, err = client.GetLatestSchema("users-value")
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+	_, err = client.DeleteSubject("users-value")
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+
+	// schemas remain available by id
+	_, err = client.GetSchemaByID(id)
+	assert.NoError(t, err)
+}
+
+func TestSchemaRegistryClient_References(t *testing.T) {
+	client := kafkaavrotest.NewSchemaRegistryClient()
+
+	_, err := client.RegisterNewSchema("address", avro.MustParse(`{"type": "record", "name": "address", "fields": [{"name": "city", "type": "string"}]}`))
+	require.NoError(t, err)
+
+	id, err := client.RegisterNewSchemaWithReferences(
+		"users-value",
+		`{"type": "record", "name": "user", "fields": [{"name": "address", "type": "address"}]}`,
+		[]kafkaavro.SchemaReference{{Name: "address", Subject: "address", Version: 1}},
+	)
+	require.NoError(t, err)
+
+	schema, err := client.GetSchemaByID(id)
+	require.NoError(t, err)
+	data, err := avro.Marshal(schema, map[string]interface{}{"address": map[string]interface{}{"city": "Amsterdam"}})
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{18}, "Amsterdam"...), data)
+
+	_, err = client.RegisterNewSchemaWithReferences(
+		"users-value",
+		`{"type": "record", "name": "user", "fields": [{"name": "address", "type": "address"}]}`,
+		[]kafkaavro.SchemaReference{{Name: "address", Subject: "missing", Version: 1}},
+	)
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+}
+
+func TestSchemaRegistryClient_GetReferencedSchemas(t *testing.T) {
+	client := kafkaavrotest.NewSchemaRegistryClient()
+
+	const city = `{"type": "string", "minLength": 1}`
+	const address = `{"type": "object", "properties": {"city": {"$ref": "city.json"}}}`
+	_, err := client.RegisterNewSchemaOfType("city", kafkaavro.SchemaTypeJSON, city, nil)
+	require.NoError(t, err)
+	_, err = client.RegisterNewSchemaOfType("address", kafkaavro.SchemaTypeJSON, address,
+		[]kafkaavro.SchemaReference{{Name: "city.json", Subject: "city", Version: 1}})
+	require.NoError(t, err)
+
+	referenced, err := client.GetReferencedSchemas([]kafkaavro.SchemaReference{{Name: "address.json", Subject: "address"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"address.json": address, "city.json": city}, referenced)
+
+	_, err = client.GetReferencedSchemas([]kafkaavro.SchemaReference{{Name: "missing.json", Subject: "missing"}})
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+}
+
+func TestSchemaRegistryClient_RoundTrip(t *testing.T) {
+	client := kafkaavrotest.NewSchemaRegistryClient()
+
+	type user struct {
+		Name string `avro:"name"`
+	}
+
+	s, err := kafkaavro.NewAvroSerializer(client, "users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	data, err := s.Serialize(user{Name: "jane"})
+	require.NoError(t, err)
+
+	var out user
+	require.NoError(t, kafkaavro.NewAvroDeserializer(client).Deserialize(data, &out))
+	assert.Equal(t, "jane", out.Name)
+}
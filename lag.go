@@ -0,0 +1,168 @@
+package kafkaavro
+
+import (
+	"context"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// defaultTimeoutMs bounds the requests to kafka made with a context without deadline
+const defaultTimeoutMs = 6000
+
+// PartitionLag is the consumption progress of a partition assigned to the consumer
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Committed is the offset committed by the consumer group, kafka.OffsetInvalid when nothing was committed
+	Committed kafka.Offset
+	// Position is the offset of the next message to be fetched, kafka.OffsetInvalid until a message is fetched
+	Position kafka.Offset
+	// LowWatermark is the offset of the first message of the partition
+	LowWatermark int64
+	// HighWatermark is the offset following the last message of the partition
+	HighWatermark int64
+	// Lag is the number of messages after the committed offset,
+	// or after the low watermark when nothing was committed yet
+	Lag int64
+}
+
+// assignmentProvider is implemented by kafka consumers reporting their assigned partitions
+type assignmentProvider interface {
+	Assignment() (partitions []kafka.TopicPartition, err error)
+}
+
+// offsetsProvider is implemented by kafka consumers reporting their committed offsets and positions
+type offsetsProvider interface {
+	Committed(partitions []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error)
+	Position(partitions []kafka.TopicPartition) (offsets []kafka.TopicPartition, err error)
+}
+
+// watermarkQuerier is implemented by kafka consumers querying the watermark offsets of partitions
+type watermarkQuerier interface {
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// Lag returns the lag of every partition currently assigned to the consumer.
+// The deadline of the context bounds the requests made to kafka.
+func (ac *Consumer) Lag(ctx context.Context) ([]PartitionLag, error) {
+	op, ok := ac.KafkaConsumer.(offsetsProvider)
+	if !ok {
+		return nil, errors.New("kafka consumer does not support offset lookups")
+	}
+	wq, ok := ac.KafkaConsumer.(watermarkQuerier)
+	if !ok {
+		return nil, errors.New("kafka consumer does not support watermark offset queries")
+	}
+	assignment, err := ac.assignment()
+	if err != nil {
+		return nil, err
+	}
+	lags := make([]PartitionLag, 0, len(assignment))
+	if len(assignment) == 0 {
+		return lags, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	committed, err := op.Committed(assignment, contextTimeoutMs(ctx))
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot get committed offsets")
+	}
+	committedOffsets, err := offsetsByPartition(committed)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot get committed offsets")
+	}
+	positions, err := op.Position(assignment)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot get positions")
+	}
+	positionOffsets, err := offsetsByPartition(positions)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot get positions")
+	}
+
+	for _, tp := range assignment {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+		low, high, err := wq.QueryWatermarkOffsets(key.topic, key.partition, contextTimeoutMs(ctx))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "cannot query watermark offsets of %s[%d]", key.topic, key.partition)
+		}
+
+		lag := PartitionLag{
+			Topic:         key.topic,
+			Partition:     key.partition,
+			Committed:     kafka.OffsetInvalid,
+			Position:      kafka.OffsetInvalid,
+			LowWatermark:  low,
+			HighWatermark: high,
+		}
+		if offset, ok := committedOffsets[key]; ok {
+			lag.Committed = offset
+		}
+		if offset, ok := positionOffsets[key]; ok {
+			lag.Position = offset
+		}
+		start := low
+		if lag.Committed >= 0 {
+			start = int64(lag.Committed)
+		}
+		if high > start {
+			lag.Lag = high - start
+		}
+		lags = append(lags, lag)
+	}
+	return lags, nil
+}
+
+// assignment returns the partitions assigned to the consumer
+func (ac *Consumer) assignment() ([]kafka.TopicPartition, error) {
+	ap, ok := ac.KafkaConsumer.(assignmentProvider)
+	if !ok {
+		return nil, errors.New("kafka consumer does not support assignment lookups")
+	}
+	assignment, err := ap.Assignment()
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot get assignment")
+	}
+	return assignment, nil
+}
+
+// offsetsByPartition indexes the offsets by partition, failing on the first partition error
+func offsetsByPartition(offsets []kafka.TopicPartition) (map[partitionKey]kafka.Offset, error) {
+	indexed := make(map[partitionKey]kafka.Offset, len(offsets))
+	for _, tp := range offsets {
+		if tp.Topic == nil {
+			continue
+		}
+		if tp.Error != nil {
+			return nil, errors.WithMessagef(tp.Error, "%s[%d]", *tp.Topic, tp.Partition)
+		}
+		indexed[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = tp.Offset
+	}
+	return indexed, nil
+}
+
+// contextTimeoutMs returns the milliseconds left before the deadline of the context,
+// defaultTimeoutMs when it has none
+func contextTimeoutMs(ctx context.Context) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultTimeoutMs
+	}
+	timeoutMs := int(time.Until(deadline) / time.Millisecond)
+	if timeoutMs < 1 {
+		return 1
+	}
+	return timeoutMs
+}
@@ -0,0 +1,93 @@
+package kafkaavro_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_Lag(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 2)
+	kp := broker.NewKafkaProducer()
+	topic := "topic"
+	for partition, count := range []int{3, 2} {
+		for i := 0; i < count; i++ {
+			require.NoError(t, kp.Produce(&kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: int32(partition)},
+				Value:          []byte("value"),
+			}, nil))
+		}
+	}
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"topic"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+	)
+	require.NoError(t, err)
+
+	// partitions are polled in turn, the first message of each partition is consumed
+	first := c.Poll(100).(*kafka.Message)
+	require.Equal(t, int32(0), first.TopicPartition.Partition)
+	require.NotNil(t, c.Poll(100))
+	_, err = c.CommitMessage(first)
+	require.NoError(t, err)
+
+	lags, err := c.Lag(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []kafkaavro.PartitionLag{
+		{Topic: "topic", Partition: 0, Committed: 1, Position: 1, LowWatermark: 0, HighWatermark: 3, Lag: 2},
+		{Topic: "topic", Partition: 1, Committed: kafka.OffsetInvalid, Position: 1, LowWatermark: 0, HighWatermark: 2, Lag: 2},
+	}, lags)
+}
+
+func TestConsumer_LagErrors(t *testing.T) {
+	kc := &mockKafkaConsumer{}
+	c := newEventsConsumer(t, kc)
+
+	kc.On("Assignment").Return([]kafka.TopicPartition{}, errors.New("not subscribed")).Once()
+	_, err := c.Lag(context.Background())
+	assert.EqualError(t, err, "cannot get assignment: not subscribed")
+
+	topic := "topic"
+	kc.On("Assignment").Return([]kafka.TopicPartition{{Topic: &topic, Partition: 0}}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Lag(ctx)
+	assert.Equal(t, context.Canceled, err)
+	kc.AssertNumberOfCalls(t, "Committed", 0)
+}
+
+// basicKafkaConsumer hides the optional methods of the kafka consumer it wraps
+type basicKafkaConsumer struct {
+	kafkaavro.KafkaConsumer
+}
+
+func newBasicConsumer(t *testing.T) *kafkaavro.Consumer {
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(basicKafkaConsumer{&mockKafkaConsumer{}}),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+	)
+	require.NoError(t, err)
+	return c
+}
+
+func TestConsumer_LagUnsupported(t *testing.T) {
+	c := newBasicConsumer(t)
+	_, err := c.Lag(context.Background())
+	assert.EqualError(t, err, "kafka consumer does not support offset lookups")
+}
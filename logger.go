@@ -0,0 +1,100 @@
+package kafkaavro
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Logger is a leveled structured logger, args are alternating keys and values.
+// A *slog.Logger satisfies Logger as is.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// NewStdLogger returns a logger writing info, warn and error entries to the standard logger
+// as key=value pairs, it is the default logger of producers, consumers and registry clients
+func NewStdLogger() Logger {
+	return stdLogger{}
+}
+
+// NopLogger returns a logger discarding every entry
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Debug(string, ...interface{}) {}
+
+func (l stdLogger) Info(msg string, args ...interface{}) {
+	l.log("INFO", msg, args)
+}
+
+func (l stdLogger) Warn(msg string, args ...interface{}) {
+	l.log("WARN", msg, args)
+}
+
+func (l stdLogger) Error(msg string, args ...interface{}) {
+	l.log("ERROR", msg, args)
+}
+
+func (stdLogger) log(level string, msg string, args []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "level=%s msg=%q", level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " !BADKEY=%q", fmt.Sprint(args[i]))
+			break
+		}
+		fmt.Fprintf(&b, " %v=%q", args[i], fmt.Sprint(args[i+1]))
+	}
+	log.Println(b.String())
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// messageFields returns the log fields locating the message
+func messageFields(tp kafka.TopicPartition) []interface{} {
+	var topic string
+	if tp.Topic != nil {
+		topic = *tp.Topic
+	}
+	return []interface{}{"topic", topic, "partition", tp.Partition, "offset", int64(tp.Offset)}
+}
+
+// logEvent logs a kafka event other than a message at a level matching its kind
+func logEvent(logger Logger, event kafka.Event) {
+	switch e := event.(type) {
+	case kafka.Error:
+		if e.IsFatal() {
+			logger.Error("kafka error", "error", e, "code", int(e.Code()), "fatal", true)
+		} else {
+			logger.Warn("kafka error", "error", e, "code", int(e.Code()), "fatal", false)
+		}
+	case kafka.AssignedPartitions:
+		logger.Info("partitions assigned", "partitions", e.Partitions)
+	case kafka.RevokedPartitions:
+		logger.Info("partitions revoked", "partitions", e.Partitions)
+	case kafka.PartitionEOF:
+		logger.Debug("partition end reached", messageFields(kafka.TopicPartition(e))...)
+	case kafka.OffsetsCommitted:
+		if e.Error != nil {
+			logger.Error("offsets commit failed", "error", e.Error, "offsets", e.Offsets)
+		} else {
+			logger.Debug("offsets committed", "offsets", e.Offsets)
+		}
+	default:
+		logger.Debug("kafka event", "event", e)
+	}
+}
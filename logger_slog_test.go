@@ -0,0 +1,44 @@
+//go:build go1.21
+// +build go1.21
+
+package kafkaavro_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumer_SlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	kc.On("Poll", 100).Return(kafka.NewError(kafka.ErrTransport, "broker down", true))
+	_, err = c.FetchMessage(100)
+	require.True(t, kafkaavro.IsErrFatal(err))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "kafka error", entry["msg"])
+	assert.Equal(t, float64(kafka.ErrTransport), entry["code"])
+	assert.Equal(t, true, entry["fatal"])
+}
@@ -0,0 +1,118 @@
+package kafkaavro_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLogger keeps the entries it logs formatted as "LEVEL msg key=value..."
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level string, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		entry += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg, args) }
+
+func TestConsumer_Logger(t *testing.T) {
+	logger := &recordingLogger{}
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	kc.On("Poll", 100).Return(kafka.NewError(kafka.ErrTransport, "broker down", false)).Once()
+	kc.On("Poll", 100).Return(kafka.PartitionEOF{Topic: &topic, Partition: 1, Offset: 5}).Once()
+	for i := 0; i < 2; i++ {
+		msg, err := c.FetchMessage(100)
+		require.NoError(t, err)
+		assert.Nil(t, msg)
+	}
+
+	kc.On("CommitMessage", mock.AnythingOfType("*kafka.Message")).Return([]kafka.TopicPartition{}, errors.New("commit failed"))
+	_, err = c.CommitMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 7}})
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{
+		"WARN kafka error error=broker down code=-195 fatal=false",
+		"DEBUG partition end reached topic=topic partition=1 offset=5",
+		"ERROR commit failed topic=topic partition=2 offset=7 error=commit failed",
+	}, logger.entries)
+}
+
+func TestProducer_LoggerRetries(t *testing.T) {
+	logger := &recordingLogger{}
+	kp := &mockKafkaProducer{}
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithBackoff(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1)),
+		kafkaavro.WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(errors.New("queue full")).Once()
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", "value", nil))
+
+	assert.Equal(t, []string{
+		"ERROR produce failed topic=topic error=queue full",
+		"WARN retrying produce topic=topic error=queue full wait=0s",
+	}, logger.entries)
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	output, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	}()
+
+	logger := kafkaavro.NewStdLogger()
+	logger.Debug("hidden")
+	logger.Warn("kafka error", "error", "broker down", "fatal", false)
+	logger.Error("dangling", "key")
+
+	assert.Equal(t, []string{
+		`level=WARN msg="kafka error" error="broker down" fatal="false"`,
+		`level=ERROR msg="dangling" !BADKEY="key"`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
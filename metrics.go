@@ -0,0 +1,52 @@
+package kafkaavro
+
+import "time"
+
+// Schema caches of CachedSchemaRegistryClient as reported to Metrics
+const (
+	SchemaCacheID         = "id"
+	SchemaCacheVersion    = "version"
+	SchemaCacheLatest     = "latest"
+	SchemaCacheRegistered = "registered"
+)
+
+// Metrics receives measurements from producers, consumers and the schema registry client.
+// Implementations must be safe for concurrent use, the kafkaavroprom package provides
+// one exposing Prometheus metrics.
+type Metrics interface {
+	// MessageProduced counts a message delivered, or enqueued when the caller handles delivery reports
+	MessageProduced(topic string)
+	// MessageConsumed counts a message fetched, whether or not it could be decoded
+	MessageConsumed(topic string)
+	// Encoded reports the time spent serializing the key and value of a message
+	Encoded(topic string, duration time.Duration, err error)
+	// Decoded reports the time spent deserializing the value of a message
+	Decoded(topic string, duration time.Duration, err error)
+	// DeliveryFailed counts a message rejected by the kafka producer or failing delivery. Delivery reports
+	// sent to a deliveryChan passed by the caller are left to the caller and not counted.
+	DeliveryFailed(topic string)
+	// CommitFailed counts a failed offset commit
+	CommitFailed(topic string)
+	// ProduceRetried counts a produce attempt retried by the producer backoff
+	ProduceRetried(topic string)
+	// SchemaCacheHit counts a lookup served by one of the schema caches
+	SchemaCacheHit(cache string)
+	// SchemaCacheMiss counts a lookup that had to go to the schema registry
+	SchemaCacheMiss(cache string)
+	// SchemaFetched reports the duration of a schema registry request made on a cache miss
+	SchemaFetched(cache string, duration time.Duration, err error)
+}
+
+// nopMetrics discards measurements, it is used when no metrics are configured
+type nopMetrics struct{}
+
+func (nopMetrics) MessageProduced(string)                     {}
+func (nopMetrics) MessageConsumed(string)                     {}
+func (nopMetrics) Encoded(string, time.Duration, error)       {}
+func (nopMetrics) Decoded(string, time.Duration, error)       {}
+func (nopMetrics) DeliveryFailed(string)                      {}
+func (nopMetrics) CommitFailed(string)                        {}
+func (nopMetrics) ProduceRetried(string)                      {}
+func (nopMetrics) SchemaCacheHit(string)                      {}
+func (nopMetrics) SchemaCacheMiss(string)                     {}
+func (nopMetrics) SchemaFetched(string, time.Duration, error) {}
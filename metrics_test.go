@@ -0,0 +1,131 @@
+package kafkaavro_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetrics counts the measurements by name, label and whether they carried an error
+type recordingMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{counts: map[string]int{}}
+}
+
+func (m *recordingMetrics) record(name string, label string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := name + ":" + label
+	if err != nil {
+		key += ":error"
+	}
+	m.counts[key]++
+}
+
+func (m *recordingMetrics) count(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[key]
+}
+
+func (m *recordingMetrics) MessageProduced(topic string) { m.record("produced", topic, nil) }
+func (m *recordingMetrics) MessageConsumed(topic string) { m.record("consumed", topic, nil) }
+func (m *recordingMetrics) Encoded(topic string, _ time.Duration, err error) {
+	m.record("encoded", topic, err)
+}
+func (m *recordingMetrics) Decoded(topic string, _ time.Duration, err error) {
+	m.record("decoded", topic, err)
+}
+func (m *recordingMetrics) DeliveryFailed(topic string) { m.record("delivery_failed", topic, nil) }
+func (m *recordingMetrics) CommitFailed(topic string)   { m.record("commit_failed", topic, nil) }
+func (m *recordingMetrics) ProduceRetried(topic string) { m.record("retried", topic, nil) }
+func (m *recordingMetrics) SchemaCacheHit(cache string) { m.record("hit", cache, nil) }
+func (m *recordingMetrics) SchemaCacheMiss(cache string) {
+	m.record("miss", cache, nil)
+}
+func (m *recordingMetrics) SchemaFetched(cache string, _ time.Duration, err error) {
+	m.record("fetched", cache, err)
+}
+
+func TestProducer_Metrics(t *testing.T) {
+	metrics := newRecordingMetrics()
+	kp := &mockKafkaProducer{}
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithBackoff(backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1)),
+		kafkaavro.WithMetrics(metrics),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(errors.New("queue full")).Once()
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", "value", nil))
+
+	assert.Error(t, p.Produce("key", 1, nil))
+
+	assert.Equal(t, 1, metrics.count("produced:topic"))
+	assert.Equal(t, 1, metrics.count("delivery_failed:topic"))
+	assert.Equal(t, 2, metrics.count("encoded:topic"))
+	// the unsupported value is retried like the rejected message
+	assert.Equal(t, 2, metrics.count("encoded:topic:error"))
+	assert.Equal(t, 2, metrics.count("retried:topic"))
+}
+
+func TestConsumer_Metrics(t *testing.T) {
+	metrics := newRecordingMetrics()
+	c, kc := newDecodeErrorConsumer(t, kafkaavro.WithMetrics(metrics))
+	kc.On("CommitMessage", mock.AnythingOfType("*kafka.Message")).Return([]kafka.TopicPartition{}, errors.New("commit failed"))
+
+	msg, err := c.FetchMessage(100)
+	assert.True(t, kafkaavro.IsErrDecode(err))
+
+	_, err = c.CommitMessage(msg.Message)
+	assert.Error(t, err)
+
+	assert.Equal(t, 1, metrics.count("consumed:topic"))
+	assert.Equal(t, 1, metrics.count("decoded:topic:error"))
+	assert.Equal(t, 1, metrics.count("commit_failed:topic"))
+}
+
+func TestCachedSchemaRegistryClient_Metrics(t *testing.T) {
+	testObject := createSchemaRegistryTestObject(t, "test", 1)
+	defer testObject.MockServer.Close()
+	metrics := newRecordingMetrics()
+	client, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(testObject.MockServer.URL, kafkaavro.WithRegistryMetrics(metrics))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = client.GetSchemaByID(1)
+		require.NoError(t, err)
+		_, err = client.RegisterNewSchema("test", testObject.Schema)
+		require.NoError(t, err)
+	}
+	_, err = client.GetSchemaByID(2)
+	assert.Error(t, err)
+
+	for _, cache := range []string{kafkaavro.SchemaCacheID, kafkaavro.SchemaCacheRegistered} {
+		assert.Equal(t, 1, metrics.count("hit:"+cache), cache)
+	}
+	assert.Equal(t, 2, metrics.count("miss:"+kafkaavro.SchemaCacheID))
+	assert.Equal(t, 1, metrics.count("fetched:"+kafkaavro.SchemaCacheID))
+	assert.Equal(t, 1, metrics.count(fmt.Sprintf("fetched:%s:error", kafkaavro.SchemaCacheID)))
+	assert.Equal(t, 1, metrics.count("miss:"+kafkaavro.SchemaCacheRegistered))
+	assert.Equal(t, 1, metrics.count("fetched:"+kafkaavro.SchemaCacheRegistered))
+}
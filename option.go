@@ -1,11 +1,16 @@
 package kafkaavro
 
 import (
+	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/hamba/avro"
+	schemaregistry "github.com/landoop/schema-registry"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ConsumerOption interface {
@@ -85,6 +90,87 @@ func WithSchemaRegistryClient(srClient SchemaRegistryClient) SharedOption {
 	}
 }
 
+// WithWireFormat sets how schema IDs are carried along the data. Producers write the Confluent
+// wire format by default, consumers detect the wire format unless one is set. On consumers
+// the wire format applies to the default avro deserializer and to header-carried schema IDs.
+// Producers reject WireFormatApicurioHeaders along with custom serializers or the single object encoding.
+func WithWireFormat(format WireFormat) SharedOption {
+	return funcSharedOption{
+		func(o *Consumer) {
+			o.wireFormat = format
+		},
+		func(o *Producer) {
+			o.wireFormat = format
+		},
+	}
+}
+
+// WithMetrics reports produced and consumed messages, encoding, delivery and commit failures
+// to the metrics, as well as the schema cache of the schema registry client created by default
+func WithMetrics(metrics Metrics) SharedOption {
+	return funcSharedOption{
+		func(o *Consumer) {
+			o.metrics = metrics
+		},
+		func(o *Producer) {
+			o.metrics = metrics
+		},
+	}
+}
+
+// WithLogger sets the logger of the producer or consumer, as well as of the schema registry client
+// created by default. Kafka events are logged with it unless an event handler is set.
+func WithLogger(logger Logger) SharedOption {
+	return funcSharedOption{
+		func(o *Consumer) {
+			o.logger = logger
+		},
+		func(o *Producer) {
+			o.logger = logger
+		},
+	}
+}
+
+// WithStatsHandler passes the statistics emitted every statistics.interval.ms to the handler.
+// Producers then take over the events channel of the kafka producer to receive them: the application
+// must not read Events() itself, as each event goes to a single reader, and the other events are logged.
+func WithStatsHandler(handler StatsHandler) SharedOption {
+	return funcSharedOption{
+		func(o *Consumer) {
+			o.statsHandler = handler
+		},
+		func(o *Producer) {
+			o.statsHandler = handler
+		},
+	}
+}
+
+// WithTracerProvider traces produced and consumed messages with spans of the tracer provider,
+// trace context is propagated in message headers. Requests of the schema registry client
+// created by default are traced as well.
+func WithTracerProvider(tp trace.TracerProvider) SharedOption {
+	return funcSharedOption{
+		func(o *Consumer) {
+			o.tracerProvider = tp
+		},
+		func(o *Producer) {
+			o.tracerProvider = tp
+		},
+	}
+}
+
+// WithPropagator sets how trace context is carried in message headers, W3C trace context and baggage by default
+func WithPropagator(propagator propagation.TextMapPropagator) SharedOption {
+	return funcSharedOption{
+		func(o *Consumer) {
+			o.propagator = propagator
+		},
+		func(o *Producer) {
+			o.propagator = propagator
+		},
+	}
+}
+
 type funcConsumerOption struct {
 	f func(*Consumer)
 }
@@ -111,6 +197,65 @@ func WithEventHandler(handler EventHandler) ConsumerOption {
 	}}
 }
 
+// WithEventHandlers passes kafka events other than messages to typed handlers,
+// events without a handler are still passed to the event handler
+func WithEventHandlers(handlers EventHandlers) ConsumerOption {
+	return funcConsumerOption{func(o *Consumer) {
+		o.eventHandlers = handlers
+	}}
+}
+
+// WithDecodeErrorPolicy sets what the consumer does with messages that cannot be decoded,
+// a custom policy can route them to a dead letter topic or any other handler
+func WithDecodeErrorPolicy(policy DecodeErrorPolicy) ConsumerOption {
+	return funcConsumerOption{func(o *Consumer) {
+		o.decodeErrorPolicy = policy
+	}}
+}
+
+// WithDeserializer decodes values with the deserializer instead of the default avro deserializer
+func WithDeserializer(deserializer Deserializer) ConsumerOption {
+	return funcConsumerOption{func(o *Consumer) {
+		o.deserializer = deserializer
+		o.newDeserializer = nil
+	}}
+}
+
+// WithProtobufDeserializer decodes values encoded with the Confluent Protobuf wire format
+// into the proto messages returned by the ValueFactory
+func WithProtobufDeserializer() ConsumerOption {
+	return funcConsumerOption{func(o *Consumer) {
+		o.deserializer = nil
+		o.newDeserializer = func(c *Consumer) Deserializer {
+			return &ProtobufDeserializer{WireFormat: c.wireFormat}
+		}
+	}}
+}
+
+// WithJSONDeserializer decodes values encoded with the Confluent JSON Schema wire format
+// into the values returned by the ValueFactory
+func WithJSONDeserializer() ConsumerOption {
+	return funcConsumerOption{func(o *Consumer) {
+		o.deserializer = nil
+		o.newDeserializer = func(c *Consumer) Deserializer {
+			return &JSONSchemaDeserializer{WireFormat: c.wireFormat}
+		}
+	}}
+}
+
+// WithSingleObjectSchemas decodes values using the avro single object encoding,
+// schema fingerprints are resolved against the schemas instead of the schema registry
+func WithSingleObjectSchemas(schemas ...avro.Schema) ConsumerOption {
+	return funcConsumerOption{func(o *Consumer) {
+		o.deserializer = nil
+		o.newDeserializer = func(c *Consumer) Deserializer {
+			d := NewSingleObjectDeserializer(schemas...)
+			d.API = c.avroAPI
+			return d
+		}
+	}}
+}
+
 type funcProducerOption struct {
 	f func(*Producer)
 }
@@ -130,3 +275,174 @@ func WithBackoff(backOff backoff.BackOff) ProducerOption {
 		o.backOffConfig = backOff
 	}}
 }
+
+// WithKeySerializer encodes keys with the serializer, the key schema passed to NewProducer is ignored
+func WithKeySerializer(serializer Serializer) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.keySerializer = serializer
+	}}
+}
+
+// WithValueSerializer encodes values with the serializer, the value schema passed to NewProducer is ignored
+func WithValueSerializer(serializer Serializer) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.valueSerializer = serializer
+	}}
+}
+
+// WithAvroKeySchema encodes keys with the avro schema, which replaces the avro key schema passed to NewProducer.
+// The schema may use named types of the referenced schemas, which are resolved before it is parsed.
+func WithAvroKeySchema(schema string, references ...SchemaReference) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.keySchema = &typedSchema{schemaType: SchemaTypeAvro, schema: schema, references: references}
+	}}
+}
+
+// WithAvroValueSchema encodes values with the avro schema, which replaces the avro value schema passed to NewProducer.
+// The schema may use named types of the referenced schemas, which are resolved before it is parsed.
+func WithAvroValueSchema(schema string, references ...SchemaReference) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.valueSchema = &typedSchema{schemaType: SchemaTypeAvro, schema: schema, references: references}
+	}}
+}
+
+// WithProtobufKeySchema encodes keys as proto messages described by the .proto schema,
+// which replaces the avro key schema passed to NewProducer
+func WithProtobufKeySchema(schema string, references ...SchemaReference) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.keySchema = &typedSchema{schemaType: SchemaTypeProtobuf, schema: schema, references: references}
+	}}
+}
+
+// WithProtobufValueSchema encodes values as proto messages described by the .proto schema,
+// which replaces the avro value schema passed to NewProducer
+func WithProtobufValueSchema(schema string, references ...SchemaReference) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.valueSchema = &typedSchema{schemaType: SchemaTypeProtobuf, schema: schema, references: references}
+	}}
+}
+
+// WithJSONKeySchema encodes keys as JSON validated against the JSON schema,
+// which replaces the avro key schema passed to NewProducer
+func WithJSONKeySchema(schema string, references ...SchemaReference) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.keySchema = &typedSchema{schemaType: SchemaTypeJSON, schema: schema, references: references}
+	}}
+}
+
+// WithJSONValueSchema encodes values as JSON validated against the JSON schema,
+// which replaces the avro value schema passed to NewProducer
+func WithJSONValueSchema(schema string, references ...SchemaReference) ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.valueSchema = &typedSchema{schemaType: SchemaTypeJSON, schema: schema, references: references}
+	}}
+}
+
+// WithSingleObjectEncoding encodes data using the avro single object encoding,
+// schemas are identified by fingerprint and never registered
+func WithSingleObjectEncoding() ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.singleObjectEncoding = true
+	}}
+}
+
+// WithoutSchemaAutoRegistration makes the producer look up the IDs of already registered
+// schemas instead of registering them, the equivalent of auto.register.schemas=false.
+func WithoutSchemaAutoRegistration() ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.autoRegisterSchemas = false
+	}}
+}
+
+// WithLatestSchemaVersion makes the producer encode data with the latest schema registered
+// for the topic subjects, the equivalent of use.latest.version=true. Schemas passed
+// to NewProducer are ignored and nothing gets registered.
+func WithLatestSchemaVersion() ProducerOption {
+	return funcProducerOption{func(o *Producer) {
+		o.autoRegisterSchemas = false
+		o.useLatestVersion = true
+	}}
+}
+
+type RegistryOption interface {
+	applyR(*CachedSchemaRegistryClient)
+}
+
+type funcRegistryOption struct {
+	f func(*CachedSchemaRegistryClient)
+}
+
+func (o funcRegistryOption) applyR(c *CachedSchemaRegistryClient) {
+	o.f(c)
+}
+
+// WithRegistryClientOptions passes options to the underlying schema registry client
+func WithRegistryClientOptions(options ...schemaregistry.Option) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.clientOptions = append(o.clientOptions, options...)
+	}}
+}
+
+// WithRegistryHTTPClient sets the HTTP client used for schema registry requests.
+// Prefer it over schemaregistry.UsingClient so requests made outside of the underlying client,
+// such as resolving schema references, use the same HTTP client.
+func WithRegistryHTTPClient(httpClient *http.Client) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.httpClient = httpClient
+		o.clientOptions = append(o.clientOptions, schemaregistry.UsingClient(httpClient))
+	}}
+}
+
+// WithSchemaCacheSize limits the number of entries held by each of the client caches,
+// least recently used entries are evicted first. A size of 0 means unbounded.
+func WithSchemaCacheSize(size int) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.cacheSize = size
+	}}
+}
+
+// WithLatestSchemaCacheTTL enables caching of latest schema lookups for the given duration
+func WithLatestSchemaCacheTTL(ttl time.Duration) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.latestTTL = ttl
+	}}
+}
+
+// WithNotFoundCacheTTL enables caching of not found responses for the given duration
+func WithNotFoundCacheTTL(ttl time.Duration) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.notFoundTTL = ttl
+	}}
+}
+
+// WithSchemaCacheDir persists fetched schemas and registered ids to the directory
+// and serves them from there when the schema registry is unreachable
+func WithSchemaCacheDir(dir string) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.cacheDir = dir
+	}}
+}
+
+// WithRegistryMetrics reports schema cache hits and misses and schema registry request durations to the metrics
+func WithRegistryMetrics(metrics Metrics) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.metrics = metrics
+	}}
+}
+
+// WithRegistryTracerProvider traces schema registry requests with client spans of the tracer provider,
+// schemas fetched while consuming a traced message are fetched in a child span of the consumer span.
+// Requests are traced through the client set with WithRegistryHTTPClient, which replaces a client
+// passed with schemaregistry.UsingClient.
+func WithRegistryTracerProvider(tp trace.TracerProvider) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.tracerProvider = tp
+	}}
+}
+
+// WithRegistryLogger sets the logger of the schema registry client
+func WithRegistryLogger(logger Logger) RegistryOption {
+	return funcRegistryOption{func(o *CachedSchemaRegistryClient) {
+		o.logger = logger
+	}}
+}
@@ -1,14 +1,19 @@
 package kafkaavro
 
 import (
-	"encoding/binary"
+	"context"
 	"net/url"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/hamba/avro"
+	schemaregistry "github.com/landoop/schema-registry"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type KafkaProducer interface {
@@ -28,13 +33,68 @@ type Producer struct {
 	srURL    *url.URL
 	srClient SchemaRegistryClient
 
-	keySchemaID   int
-	valueSchemaID int
+	keySerializer   Serializer
+	valueSerializer Serializer
 
-	avroKeySchema   avro.Schema
-	avroValueSchema avro.Schema
+	keySchema   *typedSchema
+	valueSchema *typedSchema
+	wireFormat  WireFormat
+
+	singleObjectEncoding bool
 
 	backOffConfig backoff.BackOff
+
+	autoRegisterSchemas bool
+	useLatestVersion    bool
+
+	metrics      Metrics
+	logger       Logger
+	statsHandler StatsHandler
+
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+	propagator     propagation.TextMapPropagator
+}
+
+// eventsProvider is implemented by kafka producers which report errors and statistics on an events channel
+type eventsProvider interface {
+	Events() chan kafka.Event
+}
+
+// schemaRegisteredChecker is implemented by schema registry clients which can
+// look up the ID of an already registered schema without registering it.
+type schemaRegisteredChecker interface {
+	IsSchemaRegistered(subject string, schema avro.Schema) (bool, schemaregistry.Schema, error)
+}
+
+// latestSchemaGetter is implemented by schema registry clients which can
+// return the latest schema registered for a subject.
+type latestSchemaGetter interface {
+	GetLatestSchema(subject string) (avro.Schema, error)
+}
+
+// latestSchemaWithIDGetter is implemented by schema registry clients which can
+// return the latest schema registered for a subject along with its ID.
+type latestSchemaWithIDGetter interface {
+	GetLatestSchemaWithID(subject string) (int, avro.Schema, error)
+}
+
+// schemaOfTypeRegisterer is implemented by schema registry clients which can
+// register schemas other than avro.
+type schemaOfTypeRegisterer interface {
+	RegisterNewSchemaOfType(subject string, schemaType string, schema string, references []SchemaReference) (int, error)
+}
+
+// schemaOfTypeChecker is implemented by schema registry clients which can
+// look up the ID of an already registered schema other than avro.
+type schemaOfTypeChecker interface {
+	LookupSchemaOfType(subject string, schemaType string, schema string, references []SchemaReference) (int, error)
+}
+
+// referencedSchemasGetter is implemented by schema registry clients which can
+// fetch the schemas referenced by a schema other than avro.
+type referencedSchemasGetter interface {
+	GetReferencedSchemas(references []SchemaReference) (map[string]string, error)
 }
 
 // NewProducer is a producer that publishes messages to kafka topic using avro serialization format
@@ -44,7 +104,10 @@ func NewProducer(
 	opts ...ProducerOption,
 ) (*Producer, error) {
 	p := &Producer{
-		avroAPI: avro.DefaultConfig,
+		avroAPI:             avro.DefaultConfig,
+		autoRegisterSchemas: true,
+		metrics:             nopMetrics{},
+		logger:              NewStdLogger(),
 	}
 	// Loop through each option
 	for _, opt := range opts {
@@ -52,6 +115,17 @@ func NewProducer(
 		opt.applyP(p)
 	}
 
+	if p.wireFormat == WireFormatApicurioHeaders {
+		// the schema ID is moved to the headers from the 8-byte prefix written by the serializers
+		// the producer builds, other serializers and the single object encoding write another prefix
+		if p.singleObjectEncoding {
+			return nil, errors.New("single object encoding does not support schema IDs in headers")
+		}
+		if p.keySerializer != nil || p.valueSerializer != nil {
+			return nil, errors.New("custom serializers do not support schema IDs in headers")
+		}
+	}
+
 	var err error
 
 	// if producer not provided - make one
@@ -100,52 +174,271 @@ func NewProducer(
 			p.srURL = envCfg.SchemaRegistry
 		}
 
-		if p.srClient, err = NewCachedSchemaRegistryClient(p.srURL.String()); err != nil {
+		registryOpts := []RegistryOption{WithRegistryMetrics(p.metrics), WithRegistryLogger(p.logger)}
+		if p.tracerProvider != nil {
+			registryOpts = append(registryOpts, WithRegistryTracerProvider(p.tracerProvider))
+		}
+		if p.srClient, err = NewCachedSchemaRegistryClientWithOptions(p.srURL.String(), registryOpts...); err != nil {
 			return nil, errors.WithMessage(err, "cannot initialize schema registry client")
 		}
 	}
 
-	p.avroKeySchema, err = avro.Parse(keySchemaJSON)
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot initialize key codec")
+	if p.keySerializer == nil {
+		schemaRegistrySubjectKey := topicName + "-key"
+		p.keySerializer, err = p.newSerializer(schemaRegistrySubjectKey, keySchemaJSON, p.keySchema)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot initialize key codec")
+		}
+	}
+
+	if p.valueSerializer == nil {
+		schemaRegistrySubjectValue := topicName + "-value"
+		p.valueSerializer, err = p.newSerializer(schemaRegistrySubjectValue, valueSchemaJSON, p.valueSchema)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot initialize value codec")
+		}
+	}
+
+	p.topicPartition = kafka.TopicPartition{
+		Topic:     &topicName,
+		Partition: kafka.PartitionAny,
+	}
+
+	if p.tracerProvider != nil {
+		p.tracer = p.tracerProvider.Tracer(tracerName)
+		if p.propagator == nil {
+			p.propagator = defaultPropagator()
+		}
+	}
+
+	if p.statsHandler != nil {
+		events, ok := p.KafkaProducer.(eventsProvider)
+		if !ok {
+			return nil, errors.New("kafka producer does not report statistics")
+		}
+		go p.handleEvents(events.Events())
+	}
+
+	return p, nil
+}
+
+// handleEvents serves the events of the kafka producer until it is closed, statistics are passed
+// to the stats handler and other events are logged. Delivery reports are not sent there as every
+// message is produced with a delivery channel, except those of messages the application produces
+// with the embedded kafka producer and no delivery channel, which are only logged.
+func (ap *Producer) handleEvents(events chan kafka.Event) {
+	for event := range events {
+		if stats, ok := event.(*kafka.Stats); ok {
+			handleStats(ap.statsHandler, ap.logger, stats)
+			continue
+		}
+		logEvent(ap.logger, event)
 	}
+}
 
-	p.avroValueSchema, err = avro.Parse(valueSchemaJSON)
+// newSerializer returns the serializer for the subject, data is encoded with protobuf or json schema
+// when such a schema was configured and with the avro schema otherwise. Avro data uses the single
+// object encoding without registering the schema when configured.
+func (ap *Producer) newSerializer(subject, schemaJSON string, typed *typedSchema) (Serializer, error) {
+	if typed != nil && typed.schemaType == SchemaTypeAvro {
+		return ap.newReferencingAvroSerializer(subject, typed)
+	}
+	if typed != nil {
+		if ap.singleObjectEncoding {
+			return nil, errors.Errorf("single object encoding is not supported for %s schemas", typed.schemaType)
+		}
+		id, err := ap.resolveSchemaOfType(subject, typed.schemaType, typed.schema, typed.references)
+		if err != nil {
+			return nil, err
+		}
+		switch typed.schemaType {
+		case SchemaTypeProtobuf:
+			return &ProtobufSerializer{SchemaID: id, WireFormat: ap.wireFormat}, nil
+		case SchemaTypeJSON:
+			referenced, err := ap.referencedSchemas(typed.references)
+			if err != nil {
+				return nil, err
+			}
+			s, err := NewJSONSchemaSerializerWithReferences(id, typed.schema, referenced)
+			if err != nil {
+				return nil, err
+			}
+			s.WireFormat = ap.wireFormat
+			return s, nil
+		default:
+			return nil, errors.Errorf("unsupported schema type: %s", typed.schemaType)
+		}
+	}
+
+	if ap.singleObjectEncoding {
+		schema, err := avro.Parse(schemaJSON)
+		if err != nil {
+			return nil, err
+		}
+		s := NewSingleObjectSerializer(schema)
+		s.API = ap.avroAPI
+		return s, nil
+	}
+
+	id, schema, err := ap.resolveSchema(subject, schemaJSON)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot initialize value codec")
+		return nil, err
+	}
+	return &AvroSerializer{API: ap.avroAPI, SchemaID: id, Schema: schema, WireFormat: ap.wireFormat}, nil
+}
+
+// newReferencingAvroSerializer returns the serializer for an avro schema using named types of the
+// schemas it references, which are fetched and parsed before it. The schema is registered or looked
+// up along with its references, unless the latest schema registered for the subject is used.
+func (ap *Producer) newReferencingAvroSerializer(subject string, typed *typedSchema) (Serializer, error) {
+	if ap.useLatestVersion && !ap.singleObjectEncoding {
+		id, schema, err := ap.latestSchema(subject)
+		if err != nil {
+			return nil, err
+		}
+		return &AvroSerializer{API: ap.avroAPI, SchemaID: id, Schema: schema, WireFormat: ap.wireFormat}, nil
 	}
 
-	schemaRegistrySubjectKey := topicName + "-key"
-	p.keySchemaID, err = p.srClient.RegisterNewSchema(schemaRegistrySubjectKey, p.avroKeySchema)
+	referenced, err := ap.referencedSchemas(typed.references)
 	if err != nil {
 		return nil, err
 	}
+	schema, err := parseWithReferencedSchemas(typed.schema, referenced)
+	if err != nil {
+		return nil, err
+	}
+	if ap.singleObjectEncoding {
+		s := NewSingleObjectSerializer(schema)
+		s.API = ap.avroAPI
+		return s, nil
+	}
 
-	schemaRegistrySubjectValue := topicName + "-value"
-	p.valueSchemaID, err = p.srClient.RegisterNewSchema(schemaRegistrySubjectValue, p.avroValueSchema)
+	id, err := ap.resolveSchemaOfType(subject, SchemaTypeAvro, typed.schema, typed.references)
 	if err != nil {
 		return nil, err
 	}
+	return &AvroSerializer{API: ap.avroAPI, SchemaID: id, Schema: schema, WireFormat: ap.wireFormat}, nil
+}
 
-	p.topicPartition = kafka.TopicPartition{
-		Topic:     &topicName,
-		Partition: kafka.PartitionAny,
+// referencedSchemas fetches the schemas the references point to by reference name
+func (ap *Producer) referencedSchemas(references []SchemaReference) (map[string]string, error) {
+	if len(references) == 0 {
+		return nil, nil
 	}
+	getter, ok := ap.srClient.(referencedSchemasGetter)
+	if !ok {
+		return nil, errors.New("schema registry client does not support resolving schema references")
+	}
+	return getter.GetReferencedSchemas(references)
+}
 
-	return p, nil
+// resolveSchemaOfType registers or looks up a schema other than avro and returns its ID
+func (ap *Producer) resolveSchemaOfType(subject, schemaType, schema string, references []SchemaReference) (int, error) {
+	if ap.useLatestVersion {
+		return 0, errors.Errorf("latest schema version is not supported for %s schemas", schemaType)
+	}
+	if ap.autoRegisterSchemas {
+		registerer, ok := ap.srClient.(schemaOfTypeRegisterer)
+		if !ok {
+			return 0, errors.Errorf("schema registry client does not support registering %s schemas", schemaType)
+		}
+		return registerer.RegisterNewSchemaOfType(subject, schemaType, schema, references)
+	}
+	checker, ok := ap.srClient.(schemaOfTypeChecker)
+	if !ok {
+		return 0, errors.Errorf("schema registry client does not support %s schema lookups", schemaType)
+	}
+	return checker.LookupSchemaOfType(subject, schemaType, schema, references)
+}
+
+// resolveSchema returns the schema and its ID that will be used to encode data for the subject.
+// Depending on the producer configuration the schema is registered, looked up or
+// replaced by the latest schema registered for the subject.
+func (ap *Producer) resolveSchema(subject, schemaJSON string) (int, avro.Schema, error) {
+	if ap.useLatestVersion {
+		return ap.latestSchema(subject)
+	}
+
+	schema, err := avro.Parse(schemaJSON)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var id int
+	if ap.autoRegisterSchemas {
+		id, err = ap.srClient.RegisterNewSchema(subject, schema)
+	} else {
+		id, err = ap.lookupSchemaID(subject, schema)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, schema, nil
+}
+
+// latestSchema returns the latest schema registered for the subject and its ID
+func (ap *Producer) latestSchema(subject string) (int, avro.Schema, error) {
+	if getter, ok := ap.srClient.(latestSchemaWithIDGetter); ok {
+		return getter.GetLatestSchemaWithID(subject)
+	}
+	// clients which only return the latest schema need another lookup for its ID
+	getter, ok := ap.srClient.(latestSchemaGetter)
+	if !ok {
+		return 0, nil, errors.New("schema registry client does not support latest schema lookups")
+	}
+	schema, err := getter.GetLatestSchema(subject)
+	if err != nil {
+		return 0, nil, err
+	}
+	id, err := ap.lookupSchemaID(subject, schema)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, schema, nil
+}
+
+// lookupSchemaID returns the ID of an identical schema already registered for the subject
+func (ap *Producer) lookupSchemaID(subject string, schema avro.Schema) (int, error) {
+	checker, ok := ap.srClient.(schemaRegisteredChecker)
+	if !ok {
+		return 0, errors.New("schema registry client does not support registered schema lookups")
+	}
+	found, registered, err := checker.IsSchemaRegistered(subject, schema)
+	if IsErrSchemaNotFound(err) {
+		// the subject itself does not exist yet
+		found, err = false, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, ErrSchemaNotRegistered{Subject: subject}
+	}
+	return registered.ID, nil
 }
 
 // Produce will try to publish message to a topic. If deliveryChan is provided then function will return immediately,
 // otherwise it will wait for delivery
-func (ap *Producer) produce(key interface{}, value interface{}, deliveryChan chan kafka.Event) error {
-	binaryKey, err := ap.getAvroBinary(ap.keySchemaID, ap.avroKeySchema, key)
+func (ap *Producer) produce(ctx context.Context, key interface{}, value interface{}, deliveryChan chan kafka.Event) error {
+	topic := *ap.topicPartition.Topic
+	binaryKey, binaryValue, err := ap.serialize(topic, key, value)
 	if err != nil {
 		return err
 	}
 
-	binaryValue, err := ap.getAvroBinary(ap.valueSchemaID, ap.avroValueSchema, value)
-	if err != nil {
-		return err
+	var headers []kafka.Header
+	if ap.wireFormat == WireFormatApicurioHeaders {
+		var keyHeader, valueHeader kafka.Header
+		if binaryKey, keyHeader, err = moveSchemaIDToHeader(binaryKey, ApicurioKeyGlobalIDHeader); err != nil {
+			return err
+		}
+		if binaryValue, valueHeader, err = moveSchemaIDToHeader(binaryValue, ApicurioValueGlobalIDHeader); err != nil {
+			return err
+		}
+		headers = []kafka.Header{keyHeader, valueHeader}
+	}
+	if ap.tracer != nil {
+		ap.propagator.Inject(ctx, headerCarrier{&headers})
 	}
 
 	handleError := false
@@ -158,8 +451,11 @@ func (ap *Producer) produce(key interface{}, value interface{}, deliveryChan cha
 		TopicPartition: ap.topicPartition,
 		Key:            binaryKey,
 		Value:          binaryValue,
+		Headers:        headers,
 	}
 	if err = ap.KafkaProducer.Produce(msg, deliveryChan); err != nil {
+		ap.metrics.DeliveryFailed(topic)
+		ap.logger.Error("produce failed", "topic", topic, "error", err)
 		return err
 	}
 
@@ -168,40 +464,61 @@ func (ap *Producer) produce(key interface{}, value interface{}, deliveryChan cha
 		m := e.(*kafka.Message)
 
 		if m.TopicPartition.Error != nil {
+			ap.metrics.DeliveryFailed(topic)
+			ap.logger.Error("delivery failed", append(messageFields(m.TopicPartition), "error", m.TopicPartition.Error)...)
 			return m.TopicPartition.Error
 		}
+		trace.SpanFromContext(ctx).SetAttributes(semconv.MessagingKafkaPartitionKey.Int64(int64(m.TopicPartition.Partition)))
 	}
 
+	ap.metrics.MessageProduced(topic)
 	return nil
 }
 
-func (ap *Producer) Produce(key interface{}, value interface{}, deliveryChan chan kafka.Event) error {
-	if ap.backOffConfig != nil {
-		return backoff.Retry(func() error {
-			return ap.produce(key, value, deliveryChan)
-		}, ap.backOffConfig)
+// serialize encodes the key and value, reporting the time spent to the metrics
+func (ap *Producer) serialize(topic string, key interface{}, value interface{}) ([]byte, []byte, error) {
+	start := time.Now()
+	binaryKey, err := ap.keySerializer.Serialize(key)
+	var binaryValue []byte
+	if err == nil {
+		binaryValue, err = ap.valueSerializer.Serialize(value)
 	}
-
-	return ap.produce(key, value, deliveryChan)
+	ap.metrics.Encoded(topic, time.Since(start), err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return binaryKey, binaryValue, nil
 }
 
-func (ap *Producer) getAvroBinary(schemaID int, schema avro.Schema, value interface{}) ([]byte, error) {
-	binarySchemaId := make([]byte, 4)
-	binary.BigEndian.PutUint32(binarySchemaId, uint32(schemaID))
+func (ap *Producer) Produce(key interface{}, value interface{}, deliveryChan chan kafka.Event) error {
+	return ap.ProduceContext(context.Background(), key, value, deliveryChan)
+}
 
-	// Convert to binary Avro data
-	binaryValue, err := ap.avroAPI.Marshal(schema, value)
-	if err != nil {
-		return nil, err
+// ProduceContext is Produce within the span of the context. When tracing is enabled the message
+// is produced in a producer span, child of the span of the context, whose trace context is
+// propagated in the message headers. The span ends once delivered when Produce waits for delivery.
+func (ap *Producer) ProduceContext(ctx context.Context, key interface{}, value interface{}, deliveryChan chan kafka.Event) (err error) {
+	if ap.tracer != nil {
+		topic := *ap.topicPartition.Topic
+		var span trace.Span
+		ctx, span = ap.tracer.Start(ctx, topic+" send",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(messagingAttributes(topic)...),
+		)
+		defer func() {
+			endSpan(span, err)
+		}()
 	}
 
-	binaryMsg := make([]byte, 0, len(binaryValue)+5)
-	// first byte is magic byte, always 0 for now
-	binaryMsg = append(binaryMsg, byte(0))
-	// 4-byte schema ID as returned by the Schema Registry
-	binaryMsg = append(binaryMsg, binarySchemaId...)
-	// avro serialized data in Avro’s binary encoding
-	binaryMsg = append(binaryMsg, binaryValue...)
+	if ap.backOffConfig != nil {
+		return backoff.RetryNotify(func() error {
+			return ap.produce(ctx, key, value, deliveryChan)
+		}, ap.backOffConfig, func(err error, wait time.Duration) {
+			topic := *ap.topicPartition.Topic
+			ap.metrics.ProduceRetried(topic)
+			ap.logger.Warn("retrying produce", "topic", topic, "error", err, "wait", wait)
+		})
+	}
 
-	return binaryMsg, nil
+	return ap.produce(ctx, key, value, deliveryChan)
 }
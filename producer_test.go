@@ -4,7 +4,10 @@ import (
 	"testing"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	schemaregistry "github.com/landoop/schema-registry"
 	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -39,6 +42,128 @@ func TestNewProducer(t *testing.T) {
 	p.Close()
 }
 
+func TestNewProducer_WithoutSchemaAutoRegistration(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	srClient := &mockSchemaLookupClient{}
+
+	srClient.On("IsSchemaRegistered", "topic-key", mock.Anything).Return(true, schemaregistry.Schema{ID: 3}, nil)
+	srClient.On("IsSchemaRegistered", "topic-value", mock.Anything).Return(true, schemaregistry.Schema{ID: 4}, nil)
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithoutSchemaAutoRegistration(),
+	)
+	require.NoError(t, err)
+	srClient.AssertExpectations(t)
+	srClient.AssertNotCalled(t, "RegisterNewSchema", mock.Anything, mock.Anything)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", "value", nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte{0, 0, 0, 0, 3}, msg.Key[:5])
+	assert.Equal(t, []byte{0, 0, 0, 0, 4}, msg.Value[:5])
+}
+
+func TestNewProducer_WithoutSchemaAutoRegistrationNotRegistered(t *testing.T) {
+	srClient := &mockSchemaLookupClient{}
+
+	srClient.On("IsSchemaRegistered", "topic-key", mock.Anything).Return(false, schemaregistry.Schema{}, nil)
+
+	_, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(&mockKafkaProducer{}),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithoutSchemaAutoRegistration(),
+	)
+	require.Error(t, err)
+	assert.True(t, kafkaavro.IsErrSchemaNotRegistered(err))
+}
+
+func TestNewProducer_WithLatestSchemaVersion(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	srClient := &mockSchemaLookupClient{}
+
+	latest := avro.MustParse(`{"type": "record", "name": "test", "fields" : [{"name": "val", "type": "int", "default": 0}]}`)
+	srClient.On("GetLatestSchema", "topic-key").Return(avro.MustParse(`"string"`), nil)
+	srClient.On("GetLatestSchema", "topic-value").Return(latest, nil)
+	srClient.On("IsSchemaRegistered", "topic-key", mock.Anything).Return(true, schemaregistry.Schema{ID: 3}, nil)
+	srClient.On("IsSchemaRegistered", "topic-value", latest).Return(true, schemaregistry.Schema{ID: 5}, nil)
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		"",
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithLatestSchemaVersion(),
+	)
+	require.NoError(t, err)
+	srClient.AssertExpectations(t)
+	srClient.AssertNotCalled(t, "RegisterNewSchema", mock.Anything, mock.Anything)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", map[string]interface{}{"val": 1}, nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte{0, 0, 0, 0, 5, 2}, msg.Value)
+}
+
+func TestNewProducer_WithLatestSchemaVersionID(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	_, err := srClient.RegisterNewSchema("topic-key", avro.MustParse(`"string"`))
+	require.NoError(t, err)
+	id, err := srClient.RegisterNewSchema("topic-value", avro.MustParse(`"int"`))
+	require.NoError(t, err)
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		"",
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithLatestSchemaVersion(),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", 1, nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte{0, 0, 0, 0, byte(id), 2}, msg.Value)
+}
+
+type mockSchemaLookupClient struct {
+	mock.Mock
+}
+
+func (m *mockSchemaLookupClient) GetSchemaByID(id int) (avro.Schema, error) {
+	ret := m.Called(id)
+	return ret.Get(0).(avro.Schema), ret.Error(1)
+}
+
+func (m *mockSchemaLookupClient) RegisterNewSchema(subject string, schema avro.Schema) (int, error) {
+	ret := m.Called(subject, schema)
+	return ret.Int(0), ret.Error(1)
+}
+
+func (m *mockSchemaLookupClient) IsSchemaRegistered(subject string, schema avro.Schema) (bool, schemaregistry.Schema, error) {
+	ret := m.Called(subject, schema)
+	return ret.Bool(0), ret.Get(1).(schemaregistry.Schema), ret.Error(2)
+}
+
+func (m *mockSchemaLookupClient) GetLatestSchema(subject string) (avro.Schema, error) {
+	ret := m.Called(subject)
+	return ret.Get(0).(avro.Schema), ret.Error(1)
+}
+
 type mockKafkaProducer struct {
 	mock.Mock
 }
@@ -68,3 +193,71 @@ func (m *mockKafkaProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.
 func (m *mockKafkaProducer) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error) {
 	return 0, 0, nil
 }
+
+type refMoney struct {
+	Amount int64 `avro:"amount"`
+}
+
+type refOrder struct {
+	ID    string   `avro:"id"`
+	Total refMoney `avro:"total"`
+}
+
+func TestNewProducer_WithAvroValueSchemaReferences(t *testing.T) {
+	const moneySchema = `{"type": "record", "name": "Money", "namespace": "com.example.refs", "fields": [{"name": "amount", "type": "long"}]}`
+	const orderSchema = `{"type": "record", "name": "Order", "namespace": "com.example.refs", "fields": [{"name": "id", "type": "string"}, {"name": "total", "type": "com.example.refs.Money"}]}`
+	moneyRef := kafkaavro.SchemaReference{Name: "com.example.refs.Money", Subject: "money-value", Version: 1}
+
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	_, err := srClient.RegisterNewSchema("money-value", avro.MustParse(moneySchema))
+	require.NoError(t, err)
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("orders", 1)
+
+	p, err := kafkaavro.NewProducer(
+		"orders",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithAvroValueSchema(orderSchema, moneyRef),
+	)
+	require.NoError(t, err)
+	require.NoError(t, p.Produce("order-1", refOrder{ID: "order-1", Total: refMoney{Amount: 10}}, nil))
+
+	// the schema was registered along with its references, so it is found without registering it again
+	_, err = kafkaavro.NewProducer(
+		"orders",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithAvroValueSchema(orderSchema, moneyRef),
+		kafkaavro.WithoutSchemaAutoRegistration(),
+	)
+	require.NoError(t, err)
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"orders"},
+		func(topic string) interface{} {
+			return &refOrder{}
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+	)
+	require.NoError(t, err)
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	assert.Equal(t, &refOrder{ID: "order-1", Total: refMoney{Amount: 10}}, msg.Value)
+
+	_, err = kafkaavro.NewProducer(
+		"orders",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithAvroValueSchema(orderSchema),
+	)
+	require.Error(t, err)
+}
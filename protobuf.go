@@ -0,0 +1,132 @@
+package kafkaavro
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ProtobufSerializer encodes proto messages using the Confluent Protobuf wire format:
+// magic byte, schema ID, message indexes and the serialized message
+type ProtobufSerializer struct {
+	SchemaID   int
+	WireFormat WireFormat
+}
+
+func (s *ProtobufSerializer) Serialize(value interface{}) ([]byte, error) {
+	msg, ok := value.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf: %T is not a proto.Message", value)
+	}
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	binaryMsg := make([]byte, 0, len(payload)+10)
+	binaryMsg = appendSchemaID(binaryMsg, s.WireFormat, s.SchemaID)
+	binaryMsg = appendMessageIndexes(binaryMsg, messageIndexes(msg.ProtoReflect().Descriptor()))
+	return append(binaryMsg, payload...), nil
+}
+
+// ProtobufDeserializer decodes the Confluent Protobuf wire format into the given proto message,
+// the message type determines how the payload is read. The message indexes of the data must
+// designate the same message of its .proto file as the given message, so data written with
+// another message of the file is rejected rather than read as the wrong type.
+type ProtobufDeserializer struct {
+	WireFormat WireFormat
+}
+
+func (d *ProtobufDeserializer) Deserialize(data []byte, v interface{}) error {
+	_, payload, err := readSchemaID(data, d.WireFormat)
+	if err != nil {
+		return err
+	}
+	indexes, payload, err := readMessageIndexes(payload)
+	if err != nil {
+		return err
+	}
+	if ptr, ok := v.(*interface{}); ok {
+		v = *ptr
+	}
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+	md := msg.ProtoReflect().Descriptor()
+	if expected := messageIndexes(md); !equalIndexes(indexes, expected) {
+		return errors.Errorf("protobuf: message indexes %v do not match %s indexes %v", indexes, md.FullName(), expected)
+	}
+	return proto.Unmarshal(payload, msg)
+}
+
+// messageIndexes returns the path of indexes leading to the message within its .proto file
+func messageIndexes(md protoreflect.MessageDescriptor) []int {
+	var indexes []int
+	var d protoreflect.Descriptor = md
+	for {
+		indexes = append([]int{d.Index()}, indexes...)
+		parent := d.Parent()
+		if _, ok := parent.(protoreflect.MessageDescriptor); !ok {
+			return indexes
+		}
+		d = parent
+	}
+}
+
+// appendMessageIndexes writes the message indexes as zig-zag varints prefixed by their count,
+// the common case of the first message in the file is written as a single 0
+func appendMessageIndexes(buf []byte, indexes []int) []byte {
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return append(buf, 0)
+	}
+	varint := make([]byte, binary.MaxVarintLen64)
+	buf = append(buf, varint[:binary.PutVarint(varint, int64(len(indexes)))]...)
+	for _, index := range indexes {
+		buf = append(buf, varint[:binary.PutVarint(varint, int64(index))]...)
+	}
+	return buf
+}
+
+// readMessageIndexes returns the message indexes and the payload following them,
+// a count of 0 stands for the first message in the file
+func readMessageIndexes(data []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(data)
+	if n == 0 {
+		return nil, nil, ErrTruncatedPayload{Length: len(data), Expected: len(data) + 1}
+	}
+	if n < 0 || count < 0 || count > int64(len(data)) {
+		return nil, nil, errors.New("protobuf: invalid message indexes")
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+	indexes := make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		index, n := binary.Varint(data)
+		if n == 0 {
+			return nil, nil, ErrTruncatedPayload{Length: len(data), Expected: len(data) + 1}
+		} else if n < 0 || index < 0 {
+			return nil, nil, errors.New("protobuf: invalid message indexes")
+		}
+		indexes = append(indexes, int(index))
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
+
+func equalIndexes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package kafkaavro_test
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const timestampProto = `syntax = "proto3";
+package google.protobuf;
+
+message Timestamp {
+  int64 seconds = 1;
+  int32 nanos = 2;
+}
+`
+
+func TestProducer_ProtobufRoundTrip(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	srClient := &mockSchemaOfTypeClient{}
+	srClient.On("RegisterNewSchemaOfType", "topic-value", kafkaavro.SchemaTypeProtobuf, timestampProto, []kafkaavro.SchemaReference(nil)).Return(7, nil)
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithProtobufValueSchema(timestampProto),
+	)
+	require.NoError(t, err)
+	srClient.AssertExpectations(t)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	ts := &timestamppb.Timestamp{Seconds: 1600000000, Nanos: 42}
+	require.NoError(t, p.Produce("key", ts, nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	payload, err := proto.Marshal(ts)
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0, 0, 0, 0, 7, 0}, payload...), msg.Value)
+
+	err = p.Produce("key", "not a message", nil)
+	require.Error(t, err)
+
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return &timestamppb.Timestamp{}
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithProtobufDeserializer(),
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	kc.On("Poll", 100).Return(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          msg.Value,
+	})
+	consumed, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(ts, consumed.Value.(*timestamppb.Timestamp)))
+}
+
+func TestProducer_ProtobufNestedMessageIndexes(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	srClient := &mockSchemaOfTypeClient{}
+	srClient.On("RegisterNewSchemaOfType", "topic-value", kafkaavro.SchemaTypeProtobuf, "descriptor", []kafkaavro.SchemaReference(nil)).Return(1, nil)
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithProtobufValueSchema("descriptor"),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	// ExtensionRange is the first message nested in DescriptorProto, the third message of descriptor.proto
+	require.NoError(t, p.Produce("key", &descriptorpb.DescriptorProto_ExtensionRange{}, nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte{0, 0, 0, 0, 1, 4, 4, 0}, msg.Value)
+}
+
+func TestProtobufDeserializer_MessageIndexes(t *testing.T) {
+	data, err := (&kafkaavro.ProtobufSerializer{SchemaID: 1}).Serialize(&descriptorpb.DescriptorProto_ExtensionRange{Start: proto.Int32(4)})
+	require.NoError(t, err)
+
+	d := &kafkaavro.ProtobufDeserializer{}
+	var extensionRange interface{} = &descriptorpb.DescriptorProto_ExtensionRange{}
+	require.NoError(t, d.Deserialize(data, &extensionRange))
+	assert.Equal(t, int32(4), extensionRange.(*descriptorpb.DescriptorProto_ExtensionRange).GetStart())
+
+	// the data was written with another message of the file
+	assert.EqualError(t, d.Deserialize(data, &descriptorpb.DescriptorProto_ReservedRange{}),
+		"protobuf: message indexes [2 0] do not match google.protobuf.DescriptorProto.ReservedRange indexes [2 1]")
+	assert.EqualError(t, d.Deserialize(data, &descriptorpb.FileDescriptorSet{}),
+		"protobuf: message indexes [2 0] do not match google.protobuf.FileDescriptorSet indexes [0]")
+}
+
+type mockSchemaOfTypeClient struct {
+	mock.Mock
+}
+
+func (m *mockSchemaOfTypeClient) GetSchemaByID(id int) (avro.Schema, error) {
+	return avro.Parse("string")
+}
+
+func (m *mockSchemaOfTypeClient) RegisterNewSchema(subject string, schema avro.Schema) (int, error) {
+	return 1, nil
+}
+
+func (m *mockSchemaOfTypeClient) RegisterNewSchemaOfType(subject string, schemaType string, schema string, references []kafkaavro.SchemaReference) (int, error) {
+	ret := m.Called(subject, schemaType, schema, references)
+	return ret.Int(0), ret.Error(1)
+}
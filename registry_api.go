@@ -0,0 +1,110 @@
+package kafkaavro
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	schemaregistry "github.com/landoop/schema-registry"
+)
+
+const contentTypeSchemaRegistry = "application/vnd.schemaregistry.v1+json"
+
+// registrySchema is the schema representation used by the schema registry REST API,
+// including the fields not exposed by the underlying schema registry client.
+type registrySchema struct {
+	Subject    string            `json:"subject,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	ID         int               `json:"id,omitempty"`
+	SchemaType string            `json:"schemaType,omitempty"`
+	Schema     string            `json:"schema"`
+	References []SchemaReference `json:"references,omitempty"`
+}
+
+// getSchemaByID fetches the schema with the given id
+func (cached *CachedSchemaRegistryClient) getSchemaByID(ctx context.Context, id int) (registrySchema, error) {
+	var schema registrySchema
+	err := cached.requestContext(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &schema)
+	schema.ID = id
+	return schema, err
+}
+
+// getSubjectVersion fetches the schema registered to the subject at the version, which is either a number or "latest"
+func (cached *CachedSchemaRegistryClient) getSubjectVersion(subject string, version string) (registrySchema, error) {
+	var schema registrySchema
+	err := cached.request(http.MethodGet, fmt.Sprintf("/subjects/%s/versions/%s", url.PathEscape(subject), version), nil, &schema)
+	return schema, err
+}
+
+// registerSchema registers the schema to the subject and returns its id
+func (cached *CachedSchemaRegistryClient) registerSchema(subject string, schema registrySchema) (int, error) {
+	var res struct {
+		ID int `json:"id"`
+	}
+	err := cached.request(http.MethodPost, fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject)), schema, &res)
+	return res.ID, err
+}
+
+// lookupSchema returns the registered version of the schema under the subject
+func (cached *CachedSchemaRegistryClient) lookupSchema(subject string, schema registrySchema) (registrySchema, error) {
+	var res registrySchema
+	err := cached.request(http.MethodPost, fmt.Sprintf("/subjects/%s", url.PathEscape(subject)), schema, &res)
+	return res, err
+}
+
+// Ping checks that the schema registry answers requests
+func (cached *CachedSchemaRegistryClient) Ping(ctx context.Context) error {
+	var config json.RawMessage
+	if err := cached.requestContext(ctx, http.MethodGet, "/config", nil, &config); err != nil {
+		return registryError(err, "", 0)
+	}
+	return nil
+}
+
+// request performs a schema registry API call, failures are reported as schemaregistry.ResourceError
+// so they can be handled the same way as errors returned by the underlying client
+func (cached *CachedSchemaRegistryClient) request(method, path string, in, out interface{}) error {
+	return cached.requestContext(context.Background(), method, path, in, out)
+}
+
+// requestContext is request bound to the context
+func (cached *CachedSchemaRegistryClient) requestContext(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cached.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", contentTypeSchemaRegistry)
+	}
+	req.Header.Set("Accept", contentTypeSchemaRegistry+", application/vnd.schemaregistry+json, application/json")
+
+	resp, err := cached.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resErr := schemaregistry.ResourceError{
+			ErrorCode: resp.StatusCode,
+			Method:    method,
+			URI:       req.URL.String(),
+		}
+		// the registry describes errors with its own error codes, keep the status code otherwise
+		_ = json.NewDecoder(resp.Body).Decode(&resErr)
+		return resErr
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,347 @@
+// Package registryserver implements a lightweight schema registry server compatible with the
+// Confluent schema registry API, for local development and integration tests.
+package registryserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/internal/registry"
+	"github.com/pkg/errors"
+)
+
+const contentTypeSchemaRegistry = "application/vnd.schemaregistry.v1+json"
+
+// Schema registry error codes
+const (
+	errorCodeSubjectNotFound           = 40401
+	errorCodeVersionNotFound           = 40402
+	errorCodeSchemaNotFound            = 40403
+	errorCodeIncompatibleSchema        = 409
+	errorCodeInvalidSchema             = 42201
+	errorCodeInvalidVersion            = 42202
+	errorCodeInvalidCompatibilityLevel = 42203
+	errorCodeBackendError              = 50001
+	errorCodeEndpointNotFound          = 404
+	errorCodeMethodNotAllowed          = 405
+	errorCodeUnprocessableEntity       = 422
+)
+
+// Server serves the schema registry API, it implements http.Handler
+type Server struct {
+	registry *registry.Registry
+}
+
+// New returns a server keeping schemas in memory
+func New() *Server {
+	return &Server{registry: registry.New()}
+}
+
+// NewWithFile returns a server persisting schemas to the file, schemas already
+// stored in the file are served
+func NewWithFile(path string) (*Server, error) {
+	r, err := registry.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{registry: r}, nil
+}
+
+// registrySchema is the schema representation used by the schema registry API
+type registrySchema struct {
+	Subject    string                      `json:"subject,omitempty"`
+	Version    int                         `json:"version,omitempty"`
+	ID         int                         `json:"id,omitempty"`
+	SchemaType string                      `json:"schemaType,omitempty"`
+	Schema     string                      `json:"schema"`
+	References []kafkaavro.SchemaReference `json:"references,omitempty"`
+}
+
+// rawSchema is written as is rather than JSON encoded
+type rawSchema string
+
+type errorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+type apiError struct {
+	status int
+	errorResponse
+}
+
+func (e apiError) Error() string {
+	return e.Message
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, err := splitPath(r.URL.EscapedPath())
+	if err != nil {
+		writeError(w, apiError{http.StatusNotFound, errorResponse{errorCodeEndpointNotFound, "HTTP 404 Not Found"}})
+		return
+	}
+	result, err := s.route(r, path)
+	if err != nil {
+		writeError(w, toAPIError(err))
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeSchemaRegistry)
+	if raw, ok := result.(rawSchema); ok {
+		_, _ = w.Write([]byte(raw))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// route dispatches the request on its unescaped path segments
+func (s *Server) route(r *http.Request, path []string) (interface{}, error) {
+	switch {
+	case match(path, "subjects"):
+		return s.handle(r, http.MethodGet, func() (interface{}, error) {
+			return s.registry.Subjects(), nil
+		})
+	case match(path, "subjects", "*"):
+		switch r.Method {
+		case http.MethodPost:
+			return s.lookup(r, path[1])
+		case http.MethodDelete:
+			return s.registry.DeleteSubject(path[1])
+		}
+	case match(path, "subjects", "*", "versions"):
+		switch r.Method {
+		case http.MethodGet:
+			return s.registry.Versions(path[1])
+		case http.MethodPost:
+			return s.register(r, path[1])
+		}
+	case match(path, "subjects", "*", "versions", "*"):
+		version, err := parseVersion(path[3])
+		if err != nil {
+			return nil, err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			schema, err := s.registry.Version(path[1], version)
+			if err != nil {
+				return nil, err
+			}
+			return newRegistrySchema(schema), nil
+		case http.MethodDelete:
+			return s.registry.DeleteVersion(path[1], version)
+		}
+	case match(path, "subjects", "*", "versions", "*", "schema"):
+		version, err := parseVersion(path[3])
+		if err != nil {
+			return nil, err
+		}
+		return s.handle(r, http.MethodGet, func() (interface{}, error) {
+			schema, err := s.registry.Version(path[1], version)
+			if err != nil {
+				return nil, err
+			}
+			return rawSchema(schema.Schema), nil
+		})
+	case match(path, "schemas", "ids", "*"):
+		id, err := strconv.Atoi(path[2])
+		if err != nil {
+			return nil, registry.ErrSchemaNotFound
+		}
+		return s.handle(r, http.MethodGet, func() (interface{}, error) {
+			schema, err := s.registry.SchemaByID(id)
+			if err != nil {
+				return nil, err
+			}
+			return registrySchema{SchemaType: schemaType(schema), Schema: schema.Schema, References: schema.References}, nil
+		})
+	case match(path, "schemas", "types"):
+		return s.handle(r, http.MethodGet, func() (interface{}, error) {
+			return []string{kafkaavro.SchemaTypeAvro, kafkaavro.SchemaTypeJSON, kafkaavro.SchemaTypeProtobuf}, nil
+		})
+	case match(path, "compatibility", "subjects", "*", "versions", "*"):
+		version, err := parseVersion(path[4])
+		if err != nil {
+			return nil, err
+		}
+		return s.handle(r, http.MethodPost, func() (interface{}, error) {
+			return s.checkCompatibility(r, path[2], version)
+		})
+	case match(path, "config"):
+		return s.config(r, "")
+	case match(path, "config", "*"):
+		return s.config(r, path[1])
+	default:
+		return nil, apiError{http.StatusNotFound, errorResponse{errorCodeEndpointNotFound, "HTTP 404 Not Found"}}
+	}
+	return nil, methodNotAllowed()
+}
+
+// handle runs fn for requests with the method
+func (s *Server) handle(r *http.Request, method string, fn func() (interface{}, error)) (interface{}, error) {
+	if r.Method != method {
+		return nil, methodNotAllowed()
+	}
+	return fn()
+}
+
+func (s *Server) register(r *http.Request, subject string) (interface{}, error) {
+	schema, err := readSchema(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.registry.Register(subject, schema)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"id": id}, nil
+}
+
+func (s *Server) lookup(r *http.Request, subject string) (interface{}, error) {
+	schema, err := readSchema(r)
+	if err != nil {
+		return nil, err
+	}
+	registered, err := s.registry.Lookup(subject, schema)
+	if err != nil {
+		return nil, err
+	}
+	return newRegistrySchema(registered), nil
+}
+
+func (s *Server) checkCompatibility(r *http.Request, subject string, version int) (interface{}, error) {
+	schema, err := readSchema(r)
+	if err != nil {
+		return nil, err
+	}
+	err = s.registry.CheckCompatibility(subject, version, schema)
+	if kafkaavro.IsErrSchemaIncompatible(err) {
+		return map[string]bool{"is_compatible": false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"is_compatible": true}, nil
+}
+
+func (s *Server) config(r *http.Request, subject string) (interface{}, error) {
+	switch r.Method {
+	case http.MethodGet:
+		return map[string]string{"compatibilityLevel": s.registry.Compatibility(subject)}, nil
+	case http.MethodPut:
+		var body struct {
+			Compatibility string `json:"compatibility"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, unprocessable(err)
+		}
+		if err := s.registry.SetCompatibility(subject, strings.ToUpper(body.Compatibility)); err != nil {
+			return nil, err
+		}
+		return map[string]string{"compatibility": strings.ToUpper(body.Compatibility)}, nil
+	}
+	return nil, methodNotAllowed()
+}
+
+func readSchema(r *http.Request) (registry.Schema, error) {
+	var body registrySchema
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return registry.Schema{}, unprocessable(err)
+	}
+	return registry.Schema{SchemaType: body.SchemaType, Schema: body.Schema, References: body.References}, nil
+}
+
+func newRegistrySchema(schema registry.Schema) registrySchema {
+	return registrySchema{
+		Subject:    schema.Subject,
+		Version:    schema.Version,
+		ID:         schema.ID,
+		SchemaType: schemaType(schema),
+		Schema:     schema.Schema,
+		References: schema.References,
+	}
+}
+
+// schemaType omits the type of avro schemas like the schema registry does
+func schemaType(schema registry.Schema) string {
+	if schema.SchemaType == kafkaavro.SchemaTypeAvro {
+		return ""
+	}
+	return schema.SchemaType
+}
+
+func parseVersion(version string) (int, error) {
+	if version == "latest" {
+		return registry.LatestVersion, nil
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v <= 0 {
+		return 0, apiError{errorCodeUnprocessableEntity, errorResponse{errorCodeInvalidVersion, "The specified version is not a valid version id"}}
+	}
+	return v, nil
+}
+
+// splitPath returns the unescaped segments of the escaped path, subjects may contain escaped slashes
+func splitPath(escaped string) ([]string, error) {
+	segments := strings.Split(strings.Trim(escaped, "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
+
+// match reports whether the path matches the pattern segments, * matches any segment
+func match(path []string, pattern ...string) bool {
+	if len(path) != len(pattern) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func methodNotAllowed() error {
+	return apiError{http.StatusMethodNotAllowed, errorResponse{errorCodeMethodNotAllowed, "HTTP 405 Method Not Allowed"}}
+}
+
+func unprocessable(err error) error {
+	return apiError{errorCodeUnprocessableEntity, errorResponse{errorCodeUnprocessableEntity, err.Error()}}
+}
+
+// toAPIError maps registry errors to schema registry error responses
+func toAPIError(err error) apiError {
+	var apiErr apiError
+	var invalidSchema registry.ErrInvalidSchema
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Cause(err) == registry.ErrSubjectNotFound:
+		return apiError{http.StatusNotFound, errorResponse{errorCodeSubjectNotFound, "Subject not found."}}
+	case errors.Cause(err) == registry.ErrVersionNotFound:
+		return apiError{http.StatusNotFound, errorResponse{errorCodeVersionNotFound, "Version not found."}}
+	case errors.Cause(err) == registry.ErrSchemaNotFound:
+		return apiError{http.StatusNotFound, errorResponse{errorCodeSchemaNotFound, "Schema not found"}}
+	case errors.Cause(err) == registry.ErrInvalidCompatibilityLevel:
+		return apiError{errorCodeUnprocessableEntity, errorResponse{errorCodeInvalidCompatibilityLevel, "Invalid compatibility level"}}
+	case errors.Cause(err) == registry.ErrReferencedSubjectNotFound, errors.As(err, &invalidSchema):
+		return apiError{errorCodeUnprocessableEntity, errorResponse{errorCodeInvalidSchema, err.Error()}}
+	case kafkaavro.IsErrSchemaIncompatible(err):
+		return apiError{http.StatusConflict, errorResponse{errorCodeIncompatibleSchema, "Schema being registered is incompatible with an earlier schema; " + err.Error()}}
+	}
+	return apiError{http.StatusInternalServerError, errorResponse{errorCodeBackendError, err.Error()}}
+}
+
+func writeError(w http.ResponseWriter, err apiError) {
+	w.Header().Set("Content-Type", contentTypeSchemaRegistry)
+	w.WriteHeader(err.status)
+	_ = json.NewEncoder(w).Encode(err.errorResponse)
+}
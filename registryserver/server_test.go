@@ -0,0 +1,172 @@
+package registryserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/registryserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	userV1 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}, {"name": "age", "type": "int"}]}`
+	userV2 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}]}`
+	userV3 = `{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}, {"name": "email", "type": "string"}]}`
+)
+
+func request(t *testing.T, method string, url string, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(data))
+}
+
+func TestServer_CachedSchemaRegistryClient(t *testing.T) {
+	server := httptest.NewServer(registryserver.New())
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	require.NoError(t, err)
+
+	id1, err := client.RegisterNewSchema("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	id2, err := client.RegisterNewSchema("users-value", avro.MustParse(userV2))
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	schema, err := client.GetSchemaByID(id2)
+	require.NoError(t, err)
+	assert.Equal(t, avro.MustParse(userV2).String(), schema.String())
+
+	latest, err := client.GetLatestSchema("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, schema.String(), latest.String())
+
+	versions, err := client.Versions("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	subjects, err := client.Subjects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users-value"}, subjects)
+
+	found, registered, err := client.IsSchemaRegistered("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, id1, registered.ID)
+
+	_, err = client.RegisterNewSchema("users-value", avro.MustParse(userV3))
+	assert.True(t, kafkaavro.IsErrSchemaIncompatible(err))
+
+	_, err = client.GetSchemaByID(42)
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+
+	versions, err = client.DeleteSubject("users-value")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+	_, err = client.Versions("users-value")
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(err))
+}
+
+func TestServer_References(t *testing.T) {
+	server := httptest.NewServer(registryserver.New())
+	defer server.Close()
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	require.NoError(t, err)
+
+	_, err = client.RegisterNewSchema("address", avro.MustParse(`{"type": "record", "name": "address", "fields": [{"name": "city", "type": "string"}]}`))
+	require.NoError(t, err)
+	id, err := client.RegisterNewSchemaWithReferences(
+		"users-value",
+		`{"type": "record", "name": "user", "fields": [{"name": "address", "type": "address"}]}`,
+		[]kafkaavro.SchemaReference{{Name: "address", Subject: "address", Version: 1}},
+	)
+	require.NoError(t, err)
+
+	schema, err := client.GetSchemaByID(id)
+	require.NoError(t, err)
+	_, err = avro.Marshal(schema, map[string]interface{}{"address": map[string]interface{}{"city": "Amsterdam"}})
+	assert.NoError(t, err)
+}
+
+func TestServer_CompatibilityAndConfig(t *testing.T) {
+	server := httptest.NewServer(registryserver.New())
+	defer server.Close()
+
+	status, body := request(t, http.MethodPost, server.URL+"/subjects/users-value/versions", `{"schema": `+quote(userV1)+`}`)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, `{"id":1}`, body)
+
+	status, body = request(t, http.MethodPost, server.URL+"/compatibility/subjects/users-value/versions/latest", `{"schema": `+quote(userV3)+`}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"is_compatible":false}`, body)
+
+	status, body = request(t, http.MethodGet, server.URL+"/config", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"compatibilityLevel":"BACKWARD"}`, body)
+
+	status, body = request(t, http.MethodPut, server.URL+"/config/users-value", `{"compatibility": "NONE"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"compatibility":"NONE"}`, body)
+
+	status, body = request(t, http.MethodPost, server.URL+"/compatibility/subjects/users-value/versions/1", `{"schema": `+quote(userV3)+`}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"is_compatible":true}`, body)
+
+	status, body = request(t, http.MethodPut, server.URL+"/config", `{"compatibility": "SOMETIMES"}`)
+	assert.Equal(t, 422, status)
+	assert.Contains(t, body, `"error_code":42203`)
+
+	status, body = request(t, http.MethodGet, server.URL+"/subjects/users-value/versions/1/schema", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, userV1, body)
+
+	status, body = request(t, http.MethodGet, server.URL+"/subjects/missing/versions/1", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Contains(t, body, `"error_code":40401`)
+
+	status, _ = request(t, http.MethodPost, server.URL+"/subjects/users-value/versions", `{"schema": "{"}`)
+	assert.Equal(t, 422, status)
+}
+
+func TestServer_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schemas.json")
+	registry, err := registryserver.NewWithFile(path)
+	require.NoError(t, err)
+	server := httptest.NewServer(registry)
+	client, err := kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	require.NoError(t, err)
+	id, err := client.RegisterNewSchema("users-value", avro.MustParse(userV1))
+	require.NoError(t, err)
+	server.Close()
+
+	registry, err = registryserver.NewWithFile(path)
+	require.NoError(t, err)
+	server = httptest.NewServer(registry)
+	defer server.Close()
+	client, err = kafkaavro.NewCachedSchemaRegistryClient(server.URL)
+	require.NoError(t, err)
+
+	schema, err := client.GetSchemaByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, avro.MustParse(userV1).String(), schema.String())
+
+	// compatibility is still checked against the persisted versions
+	_, err = client.RegisterNewSchema("users-value", avro.MustParse(userV3))
+	assert.True(t, kafkaavro.IsErrSchemaIncompatible(err))
+}
+
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,184 @@
+package kafkaavro
+
+import (
+	"context"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// replayGroupID is the group of replay consumers configured without one, replays never join it
+const replayGroupID = "kafkaavro-replay"
+
+// replayPollTimeoutMs bounds each poll of a replay so the context is checked regularly
+const replayPollTimeoutMs = 100
+
+// partitionAssigner is implemented by kafka consumers assigned partitions directly
+type partitionAssigner interface {
+	Assign(partitions []kafka.TopicPartition) (err error)
+}
+
+// ReplayHandler handles a message decoded by Replay, the replay stops with the error it returns
+type ReplayHandler func(msg *Message) error
+
+// Replay passes to the handler every message of the topics produced between from, inclusive, and to, exclusive.
+// The time range is resolved to offsets of each partition when the replay starts, and the replay returns
+// once every partition reached the offset of to, or its end when no message was produced after to yet.
+//
+// Messages are decoded with the schema registry like consumed ones, the consumer options apply.
+// Partitions are assigned to the replay consumer directly: it never joins the consumer group nor commits
+// offsets, so live consumers of the group are not disturbed. The kafka consumer is closed once the replay returns.
+func Replay(ctx context.Context, topics []string, from, to time.Time, valueFactory ValueFactory, handler ReplayHandler, opts ...ConsumerOption) error {
+	c, err := NewConsumer(nil, valueFactory, append(opts, funcConsumerOption{func(c *Consumer) {
+		c.readOnly = true
+	}})...)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ends, err := c.replayAssign(ctx, topics, from, to)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("replay started", "topics", topics, "from", from, "to", to, "partitions", len(ends))
+
+	for len(ends) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch e := c.KafkaConsumer.Poll(replayPollTimeoutMs).(type) {
+		case nil:
+		case *kafka.Message:
+			key := partitionKey{topic: *e.TopicPartition.Topic, partition: e.TopicPartition.Partition}
+			end, ok := ends[key]
+			if !ok {
+				continue
+			}
+			if e.TopicPartition.Offset+1 >= end {
+				delete(ends, key)
+			}
+			if e.TopicPartition.Offset >= end {
+				continue
+			}
+			msg, err := c.decodeMessage(e)
+			if err != nil {
+				c.endSpan(err)
+				return err
+			}
+			if msg == nil {
+				// skipped by the decode error policy
+				c.endSpan(nil)
+				continue
+			}
+			err = handler(msg)
+			c.endSpan(err)
+			if err != nil {
+				return err
+			}
+		case kafka.PartitionEOF:
+			// offsets of transaction markers are never consumed, the end of the partition completes it
+			key := partitionKey{topic: *e.Topic, partition: e.Partition}
+			if end, ok := ends[key]; ok && e.Offset >= end {
+				delete(ends, key)
+			}
+		default:
+			if err := c.dispatchEvent(e); err != nil {
+				return err
+			}
+		}
+	}
+	c.logger.Info("replay completed", "topics", topics, "from", from, "to", to)
+	return nil
+}
+
+// replayAssign assigns the partitions of the topics from the offset of from and returns the offset
+// of to of every partition which has messages to replay
+func (ac *Consumer) replayAssign(ctx context.Context, topics []string, from, to time.Time) (map[partitionKey]kafka.Offset, error) {
+	pa, ok := ac.KafkaConsumer.(partitionAssigner)
+	if !ok {
+		return nil, errors.New("kafka consumer does not support assigning partitions")
+	}
+	wq, ok := ac.KafkaConsumer.(watermarkQuerier)
+	if !ok {
+		return nil, errors.New("kafka consumer does not support watermark offset queries")
+	}
+	var partitions []kafka.TopicPartition
+	for _, topic := range topics {
+		topic := topic
+		meta, err := ac.KafkaConsumer.GetMetadata(&topic, false, contextTimeoutMs(ctx))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "cannot get metadata of topic %s", topic)
+		}
+		topicMeta, ok := meta.Topics[topic]
+		if !ok || topicMeta.Error.Code() != kafka.ErrNoError || len(topicMeta.Partitions) == 0 {
+			return nil, errors.Errorf("topic not found: %s", topic)
+		}
+		for _, partition := range topicMeta.Partitions {
+			partitions = append(partitions, kafka.TopicPartition{Topic: &topic, Partition: partition.ID})
+		}
+	}
+
+	starts, err := ac.offsetsForTime(ctx, partitions, from)
+	if err != nil {
+		return nil, err
+	}
+	stops, err := ac.offsetsForTime(ctx, partitions, to)
+	if err != nil {
+		return nil, err
+	}
+
+	ends := make(map[partitionKey]kafka.Offset, len(partitions))
+	assignment := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, tp := range partitions {
+		key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+		start, ok := starts[key]
+		if !ok || start < 0 {
+			// no message was produced after from
+			continue
+		}
+		end, ok := stops[key]
+		if !ok || end < 0 {
+			// no message was produced after to yet, the replay stops at the current end of the partition
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			_, high, err := wq.QueryWatermarkOffsets(key.topic, key.partition, contextTimeoutMs(ctx))
+			if err != nil {
+				return nil, errors.WithMessagef(err, "cannot query watermark offsets of %s[%d]", key.topic, key.partition)
+			}
+			end = kafka.Offset(high)
+		}
+		if start >= end {
+			continue
+		}
+		tp.Offset = start
+		assignment = append(assignment, tp)
+		ends[key] = end
+	}
+
+	if len(assignment) == 0 {
+		return ends, nil
+	}
+	if err := pa.Assign(assignment); err != nil {
+		return nil, errors.WithMessage(err, "cannot assign partitions")
+	}
+	return ends, nil
+}
+
+// readOnlyKafkaConfig returns a copy of the kafka config which never commits nor stores offsets
+// and reports partition ends, a group id is set when missing as kafka consumers require one
+func readOnlyKafkaConfig(cfg *kafka.ConfigMap) *kafka.ConfigMap {
+	readOnly := kafka.ConfigMap{}
+	for key, value := range *cfg {
+		readOnly[key] = value
+	}
+	readOnly["enable.auto.commit"] = false
+	readOnly["enable.auto.offset.store"] = false
+	readOnly["enable.partition.eof"] = true
+	if groupID, _ := readOnly.Get("group.id", ""); groupID == "" {
+		readOnly["group.id"] = replayGroupID
+	}
+	return &readOnly
+}
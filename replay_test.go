@@ -0,0 +1,181 @@
+package kafkaavro_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var replayStart = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newReplayBroker returns a broker with a topic of two partitions holding hourly messages from replayStart,
+// three in the first partition and two in the second, valued after their partition and offset
+func newReplayBroker(t *testing.T, srClient kafkaavro.SchemaRegistryClient) *kafkaavrotest.Broker {
+	serializer, err := kafkaavro.NewAvroSerializer(srClient, "topic-value", avro.MustParse(`"string"`))
+	require.NoError(t, err)
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 2)
+	kp := broker.NewKafkaProducer()
+	topic := "topic"
+	for partition, count := range []int{3, 2} {
+		for i := 0; i < count; i++ {
+			value, err := serializer.Serialize(string(rune('a'+partition)) + string(rune('0'+i)))
+			require.NoError(t, err)
+			require.NoError(t, kp.Produce(&kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: int32(partition)},
+				Value:          value,
+				Timestamp:      replayStart.Add(time.Duration(i) * time.Hour),
+			}, nil))
+		}
+	}
+	return broker
+}
+
+func replayValues(t *testing.T, broker *kafkaavrotest.Broker, srClient kafkaavro.SchemaRegistryClient, from, to time.Time, opts ...kafkaavro.ConsumerOption) []interface{} {
+	var values []interface{}
+	err := kafkaavro.Replay(
+		context.Background(),
+		[]string{"topic"},
+		from,
+		to,
+		func(topic string) interface{} {
+			return ""
+		},
+		func(msg *kafkaavro.Message) error {
+			values = append(values, msg.Value)
+			return nil
+		},
+		append([]kafkaavro.ConsumerOption{
+			kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+			kafkaavro.WithSchemaRegistryClient(srClient),
+			kafkaavro.WithLogger(kafkaavro.NopLogger()),
+		}, opts...)...,
+	)
+	require.NoError(t, err)
+	return values
+}
+
+func TestReplay(t *testing.T) {
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	broker := newReplayBroker(t, srClient)
+
+	// a live member of the group consumed and committed the first message
+	live := broker.NewKafkaConsumer("group")
+	require.NoError(t, live.SubscribeTopics([]string{"topic"}, nil))
+	msg := live.Poll(100).(*kafka.Message)
+	_, err := live.CommitMessage(msg)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []interface{}{"a1", "b1"}, replayValues(t, broker, srClient, replayStart.Add(30*time.Minute), replayStart.Add(2*time.Hour)))
+	assert.ElementsMatch(t, []interface{}{"a0", "a1", "a2", "b0", "b1"}, replayValues(t, broker, srClient, replayStart, replayStart.Add(24*time.Hour)))
+	assert.Empty(t, replayValues(t, broker, srClient, replayStart.Add(3*time.Hour), replayStart.Add(24*time.Hour)))
+
+	// the group is left as is
+	assert.Equal(t, kafka.Offset(1), broker.CommittedOffset("group", "topic", 0))
+	assert.Equal(t, kafka.OffsetInvalid, broker.CommittedOffset("group", "topic", 1))
+	remaining := 0
+	for live.Poll(10) != nil {
+		remaining++
+	}
+	assert.Equal(t, 4, remaining)
+}
+
+func TestReplay_SkippedDecodeErrors(t *testing.T) {
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	broker := newReplayBroker(t, srClient)
+	topic := "topic"
+	require.NoError(t, broker.NewKafkaProducer().Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1},
+		Value:          []byte("garbage"),
+		Timestamp:      replayStart.Add(2 * time.Hour),
+	}, nil))
+
+	values := replayValues(t, broker, srClient, replayStart.Add(time.Hour), replayStart.Add(24*time.Hour),
+		kafkaavro.WithDecodeErrorPolicy(kafkaavro.SkipDecodeErrors()))
+	assert.ElementsMatch(t, []interface{}{"a1", "a2", "b1"}, values)
+	assert.Equal(t, kafka.OffsetInvalid, broker.CommittedOffset("group", "topic", 1))
+}
+
+func TestReplay_Errors(t *testing.T) {
+	srClient := kafkaavrotest.NewSchemaRegistryClient()
+	broker := newReplayBroker(t, srClient)
+	replay := func(topics []string, handler kafkaavro.ReplayHandler) error {
+		return kafkaavro.Replay(
+			context.Background(),
+			topics,
+			replayStart,
+			replayStart.Add(time.Hour),
+			func(topic string) interface{} {
+				return ""
+			},
+			handler,
+			kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+			kafkaavro.WithSchemaRegistryClient(srClient),
+			kafkaavro.WithLogger(kafkaavro.NopLogger()),
+		)
+	}
+
+	err := replay([]string{"missing"}, func(msg *kafkaavro.Message) error {
+		return nil
+	})
+	assert.EqualError(t, err, "topic not found: missing")
+
+	handlerErr := errors.New("handler failed")
+	calls := 0
+	err = replay([]string{"topic"}, func(msg *kafkaavro.Message) error {
+		calls++
+		return handlerErr
+	})
+	assert.Equal(t, handlerErr, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestReplay_KafkaConfigWithoutGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := kafkaavro.Replay(
+		ctx,
+		[]string{"topic"},
+		replayStart,
+		replayStart.Add(time.Hour),
+		func(topic string) interface{} {
+			return ""
+		},
+		func(msg *kafkaavro.Message) error {
+			return nil
+		},
+		kafkaavro.WithKafkaConfig(&kafka.ConfigMap{"bootstrap.servers": "127.0.0.1:1"}),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithLogger(kafkaavro.NopLogger()),
+	)
+	// the kafka consumer is created and fails reaching the broker
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot get metadata of topic topic")
+}
+
+func TestReplay_Unsupported(t *testing.T) {
+	err := kafkaavro.Replay(
+		context.Background(),
+		[]string{"topic"},
+		replayStart,
+		replayStart.Add(time.Hour),
+		func(topic string) interface{} {
+			return ""
+		},
+		func(msg *kafkaavro.Message) error {
+			return nil
+		},
+		kafkaavro.WithKafkaConsumer(basicKafkaConsumer{kafkaavrotest.NewBroker().NewKafkaConsumer("group")}),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithLogger(kafkaavro.NopLogger()),
+	)
+	assert.EqualError(t, err, "kafka consumer does not support assigning partitions")
+}
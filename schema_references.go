@@ -0,0 +1,176 @@
+package kafkaavro
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strconv"
+
+	"github.com/hamba/avro"
+)
+
+// Schema types supported by the schema registry
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+)
+
+// SchemaReference points to a schema registered under another subject,
+// which the referencing schema uses by its full name.
+type SchemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// RegisterNewSchemaWithReferences registers the schema JSON along with the schemas it references and caches the id.
+// The schema is sent as is so named types of referenced schemas are not inlined.
+func (cached *CachedSchemaRegistryClient) RegisterNewSchemaWithReferences(subject string, schemaJSON string, references []SchemaReference) (int, error) {
+	return cached.RegisterNewSchemaOfType(subject, SchemaTypeAvro, schemaJSON, references)
+}
+
+// RegisterNewSchemaOfType registers a schema of any type supported by the registry and caches the id
+func (cached *CachedSchemaRegistryClient) RegisterNewSchemaOfType(subject string, schemaType string, schema string, references []SchemaReference) (int, error) {
+	payload := newRegistrySchema(schemaType, schema, references)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	key := registeredSchema{subject: subject, fingerprint: sha256.Sum256(data)}
+	return cached.register(key, func() (int, error) {
+		return cached.registerSchema(subject, payload)
+	})
+}
+
+// LookupSchemaOfType returns the id of an identical schema of any type already registered to the subject
+func (cached *CachedSchemaRegistryClient) LookupSchemaOfType(subject string, schemaType string, schema string, references []SchemaReference) (int, error) {
+	registered, err := cached.lookupSchema(subject, newRegistrySchema(schemaType, schema, references))
+	if err != nil {
+		if isNotFound(err) {
+			return 0, ErrSchemaNotRegistered{Subject: subject}
+		}
+		return 0, registryError(err, subject, 0)
+	}
+	return registered.ID, nil
+}
+
+func newRegistrySchema(schemaType string, schema string, references []SchemaReference) registrySchema {
+	if schemaType == SchemaTypeAvro {
+		// registries predating other schema types only know avro and expect no type
+		schemaType = ""
+	}
+	return registrySchema{SchemaType: schemaType, Schema: schema, References: references}
+}
+
+// parseSchema parses a fetched schema, resolving the schemas it references first
+func (cached *CachedSchemaRegistryClient) parseSchema(schema registrySchema) (avro.Schema, error) {
+	parsed, _, err := cached.parseSchemaWithReferences(schema)
+	return parsed, err
+}
+
+// parseSchemaWithReferences parses a fetched schema and also returns the JSON of the
+// schemas it references, ordered so that every schema follows its own references
+func (cached *CachedSchemaRegistryClient) parseSchemaWithReferences(schema registrySchema) (avro.Schema, []string, error) {
+	if len(schema.References) == 0 {
+		parsed, err := avro.Parse(schema.Schema)
+		return parsed, nil, err
+	}
+	var referenced []string
+	if err := cached.resolveReferences(schema.References, &referenced, map[SchemaReference]bool{}); err != nil {
+		return nil, nil, err
+	}
+	parsed, err := parseWithReferences(schema.Schema, referenced)
+	return parsed, referenced, err
+}
+
+// parseWithReferences parses the referenced schemas in order so their names can be used by the schema
+func parseWithReferences(schemaJSON string, referenced []string) (avro.Schema, error) {
+	cache := &avro.SchemaCache{}
+	for _, ref := range referenced {
+		if _, err := avro.ParseWithCache(ref, "", cache); err != nil {
+			return nil, err
+		}
+	}
+	return avro.ParseWithCache(schemaJSON, "", cache)
+}
+
+// parseWithReferencedSchemas parses the referenced schemas, given by reference name, so their names can be
+// used by the schema. They are parsed in as many passes as it takes for each to follow the schemas it uses.
+func parseWithReferencedSchemas(schemaJSON string, referenced map[string]string) (avro.Schema, error) {
+	cache := &avro.SchemaCache{}
+	pending := make([]string, 0, len(referenced))
+	for _, ref := range referenced {
+		pending = append(pending, ref)
+	}
+	for len(pending) > 0 {
+		var unresolved []string
+		var err error
+		for _, ref := range pending {
+			if _, parseErr := avro.ParseWithCache(ref, "", cache); parseErr != nil {
+				unresolved = append(unresolved, ref)
+				err = parseErr
+			}
+		}
+		if len(unresolved) == len(pending) {
+			return nil, err
+		}
+		pending = unresolved
+	}
+	return avro.ParseWithCache(schemaJSON, "", cache)
+}
+
+// GetReferencedSchemas returns the schemas the references point to, and those they reference in turn,
+// by reference name. It lets schema types other than avro resolve their references when compiling a schema.
+func (cached *CachedSchemaRegistryClient) GetReferencedSchemas(references []SchemaReference) (map[string]string, error) {
+	referenced := make(map[string]string, len(references))
+	if err := cached.resolveReferencesByName(references, referenced); err != nil {
+		return nil, err
+	}
+	return referenced, nil
+}
+
+// resolveReferencesByName fetches referenced schemas and those they reference, keyed by reference name
+func (cached *CachedSchemaRegistryClient) resolveReferencesByName(references []SchemaReference, referenced map[string]string) error {
+	for _, ref := range references {
+		if _, ok := referenced[ref.Name]; ok {
+			continue
+		}
+		version := "latest"
+		if ref.Version > 0 {
+			version = strconv.Itoa(ref.Version)
+		}
+		schema, err := cached.getSubjectVersion(ref.Subject, version)
+		if err != nil {
+			return registryError(err, ref.Subject, 0)
+		}
+		referenced[ref.Name] = schema.Schema
+		if err = cached.resolveReferencesByName(schema.References, referenced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveReferences fetches referenced schemas depth first, appending their JSON after their own references
+func (cached *CachedSchemaRegistryClient) resolveReferences(references []SchemaReference, referenced *[]string, resolved map[SchemaReference]bool) error {
+	for _, ref := range references {
+		if resolved[ref] {
+			continue
+		}
+		resolved[ref] = true
+
+		version := "latest"
+		if ref.Version > 0 {
+			version = strconv.Itoa(ref.Version)
+		}
+		schema, err := cached.getSubjectVersion(ref.Subject, version)
+		if err != nil {
+			return registryError(err, ref.Subject, 0)
+		}
+		if err = cached.resolveReferences(schema.References, referenced, resolved); err != nil {
+			return err
+		}
+		*referenced = append(*referenced, schema.Schema)
+	}
+	return nil
+}
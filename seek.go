@@ -0,0 +1,118 @@
+package kafkaavro
+
+import (
+	"context"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// offsetsForTimesProvider is implemented by kafka consumers looking up the offsets of timestamps
+type offsetsForTimesProvider interface {
+	OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) (offsets []kafka.TopicPartition, err error)
+}
+
+// partitionSeeker is implemented by kafka consumers moving assigned partitions to an offset
+type partitionSeeker interface {
+	Seek(partition kafka.TopicPartition, timeoutMs int) error
+}
+
+// SeekToTime moves every partition assigned to the consumer to its first message produced at or after t,
+// partitions without such message are moved past their last message.
+// Seeking does not commit offsets, the consumer group moves as the following messages are committed.
+func (ac *Consumer) SeekToTime(ctx context.Context, t time.Time) error {
+	assignment, err := ac.seekAssignment()
+	if err != nil {
+		return err
+	}
+	offsets, err := ac.offsetsForTime(ctx, assignment, t)
+	if err != nil {
+		return err
+	}
+	for i, tp := range assignment {
+		offset, ok := offsets[partitionKey{topic: *tp.Topic, partition: tp.Partition}]
+		if !ok || offset < 0 {
+			offset = kafka.OffsetEnd
+		}
+		assignment[i].Offset = offset
+	}
+	return ac.seek(ctx, assignment)
+}
+
+// offsetsForTime returns the offset of the first message produced at or after t of every partition,
+// -1 when there is none
+func (ac *Consumer) offsetsForTime(ctx context.Context, partitions []kafka.TopicPartition, t time.Time) (map[partitionKey]kafka.Offset, error) {
+	op, ok := ac.KafkaConsumer.(offsetsForTimesProvider)
+	if !ok {
+		return nil, errors.New("kafka consumer does not support offsets for times lookups")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	timestamp := kafka.Offset(t.UnixNano() / int64(time.Millisecond))
+	times := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, tp := range partitions {
+		tp.Offset = timestamp
+		times = append(times, tp)
+	}
+	offsets, err := op.OffsetsForTimes(times, contextTimeoutMs(ctx))
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot get offsets for times")
+	}
+	return offsetsByPartition(offsets)
+}
+
+// SeekToOffset moves every partition assigned to the consumer to the offset.
+// Seeking does not commit offsets, the consumer group moves as the following messages are committed.
+func (ac *Consumer) SeekToOffset(ctx context.Context, offset kafka.Offset) error {
+	assignment, err := ac.seekAssignment()
+	if err != nil {
+		return err
+	}
+	for i := range assignment {
+		assignment[i].Offset = offset
+	}
+	return ac.seek(ctx, assignment)
+}
+
+// SeekToBeginning moves every partition assigned to the consumer to its first message
+func (ac *Consumer) SeekToBeginning(ctx context.Context) error {
+	return ac.SeekToOffset(ctx, kafka.OffsetBeginning)
+}
+
+// SeekToEnd moves every partition assigned to the consumer past its last message
+func (ac *Consumer) SeekToEnd(ctx context.Context) error {
+	return ac.SeekToOffset(ctx, kafka.OffsetEnd)
+}
+
+// seekAssignment returns the partitions assigned to the consumer,
+// failing when there are none since partitions are only assigned once the consumer polled
+func (ac *Consumer) seekAssignment() ([]kafka.TopicPartition, error) {
+	assignment, err := ac.assignment()
+	if err != nil {
+		return nil, err
+	}
+	if len(assignment) == 0 {
+		return nil, errors.New("no partitions assigned")
+	}
+	return assignment, nil
+}
+
+// seek moves each partition to its offset
+func (ac *Consumer) seek(ctx context.Context, offsets []kafka.TopicPartition) error {
+	ps, ok := ac.KafkaConsumer.(partitionSeeker)
+	if !ok {
+		return errors.New("kafka consumer does not support seeking")
+	}
+	for _, tp := range offsets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ac.logger.Info("seeking partition", messageFields(tp)...)
+		if err := ps.Seek(tp, contextTimeoutMs(ctx)); err != nil {
+			return errors.WithMessagef(err, "cannot seek %s[%d] to %v", *tp.Topic, tp.Partition, tp.Offset)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package kafkaavro_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pollOffsets polls the consumer until no message is left and returns the offsets polled by partition
+func pollOffsets(t *testing.T, c *kafkaavro.Consumer) map[int32][]kafka.Offset {
+	offsets := make(map[int32][]kafka.Offset)
+	for {
+		ev := c.Poll(10)
+		if ev == nil {
+			return offsets
+		}
+		msg, ok := ev.(*kafka.Message)
+		require.True(t, ok)
+		offsets[msg.TopicPartition.Partition] = append(offsets[msg.TopicPartition.Partition], msg.TopicPartition.Offset)
+	}
+}
+
+func TestConsumer_Seek(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	broker.CreateTopic("topic", 2)
+	kp := broker.NewKafkaProducer()
+	topic := "topic"
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	for partition, count := range []int{3, 2} {
+		for i := 0; i < count; i++ {
+			require.NoError(t, kp.Produce(&kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: int32(partition)},
+				Value:          []byte("value"),
+				Timestamp:      start.Add(time.Duration(i) * time.Hour),
+			}, nil))
+		}
+	}
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"topic"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithLogger(kafkaavro.NopLogger()),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+	assert.Equal(t, map[int32][]kafka.Offset{0: {0, 1, 2}, 1: {0, 1}}, pollOffsets(t, c))
+
+	require.NoError(t, c.SeekToTime(ctx, start.Add(30*time.Minute)))
+	assert.Equal(t, map[int32][]kafka.Offset{0: {1, 2}, 1: {1}}, pollOffsets(t, c))
+
+	require.NoError(t, c.SeekToTime(ctx, start.Add(2*time.Hour)))
+	assert.Equal(t, map[int32][]kafka.Offset{0: {2}}, pollOffsets(t, c))
+
+	require.NoError(t, c.SeekToBeginning(ctx))
+	assert.Equal(t, map[int32][]kafka.Offset{0: {0, 1, 2}, 1: {0, 1}}, pollOffsets(t, c))
+
+	require.NoError(t, c.SeekToOffset(ctx, 2))
+	assert.Equal(t, map[int32][]kafka.Offset{0: {2}}, pollOffsets(t, c))
+
+	require.NoError(t, c.SeekToOffset(ctx, 1))
+	require.NoError(t, c.SeekToEnd(ctx))
+	assert.Empty(t, pollOffsets(t, c))
+}
+
+func TestConsumer_SeekWithoutAssignment(t *testing.T) {
+	kc := &mockKafkaConsumer{}
+	c := newEventsConsumer(t, kc)
+	kc.On("Assignment").Return([]kafka.TopicPartition{}, nil)
+
+	assert.EqualError(t, c.SeekToTime(context.Background(), time.Now()), "no partitions assigned")
+	assert.EqualError(t, c.SeekToEnd(context.Background()), "no partitions assigned")
+	kc.AssertNumberOfCalls(t, "Seek", 0)
+}
+
+// assignedKafkaConsumer only reports its assignment on top of the KafkaConsumer interface
+type assignedKafkaConsumer struct {
+	basicKafkaConsumer
+	assignment []kafka.TopicPartition
+}
+
+func (kc assignedKafkaConsumer) Assignment() ([]kafka.TopicPartition, error) {
+	return kc.assignment, nil
+}
+
+func TestConsumer_SeekUnsupported(t *testing.T) {
+	topic := "topic"
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(assignedKafkaConsumer{
+			basicKafkaConsumer: basicKafkaConsumer{&mockKafkaConsumer{}},
+			assignment:         []kafka.TopicPartition{{Topic: &topic, Partition: 0}},
+		}),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+	)
+	require.NoError(t, err)
+
+	assert.EqualError(t, c.SeekToTime(context.Background(), time.Now()), "kafka consumer does not support offsets for times lookups")
+	assert.EqualError(t, c.SeekToEnd(context.Background()), "kafka consumer does not support seeking")
+	assert.EqualError(t, newBasicConsumer(t).SeekToEnd(context.Background()), "kafka consumer does not support assignment lookups")
+}
@@ -0,0 +1,101 @@
+package kafkaavro
+
+import (
+	"context"
+
+	"github.com/hamba/avro"
+)
+
+// Serializer encodes values of a subject into the schema registry wire format
+type Serializer interface {
+	Serialize(value interface{}) ([]byte, error)
+}
+
+// Deserializer decodes values encoded in the schema registry wire format
+type Deserializer interface {
+	Deserialize(data []byte, v interface{}) error
+}
+
+// ContextDeserializer is implemented by deserializers which can pass the context of the consumed
+// message on to the schema registry, so schema lookups are traced as part of the consumer span
+type ContextDeserializer interface {
+	DeserializeContext(ctx context.Context, data []byte, v interface{}) error
+}
+
+// contextSchemaGetter is implemented by schema registry clients which can
+// fetch schemas bound to a context.
+type contextSchemaGetter interface {
+	GetSchemaByIDContext(ctx context.Context, id int) (avro.Schema, error)
+}
+
+// typedSchema is a non avro schema registered for the data of a subject
+type typedSchema struct {
+	schemaType string
+	schema     string
+	references []SchemaReference
+}
+
+// AvroSerializer encodes values with an avro schema registered under SchemaID
+type AvroSerializer struct {
+	API        avro.API
+	SchemaID   int
+	Schema     avro.Schema
+	WireFormat WireFormat
+}
+
+// NewAvroSerializer registers the schema to the subject and returns a serializer using it
+func NewAvroSerializer(srClient SchemaRegistryClient, subject string, schema avro.Schema) (*AvroSerializer, error) {
+	id, err := srClient.RegisterNewSchema(subject, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSerializer{API: avro.DefaultConfig, SchemaID: id, Schema: schema}, nil
+}
+
+func (s *AvroSerializer) Serialize(value interface{}) ([]byte, error) {
+	// Convert to binary Avro data
+	binaryValue, err := s.API.Marshal(s.Schema, value)
+	if err != nil {
+		return nil, err
+	}
+
+	binaryMsg := make([]byte, 0, len(binaryValue)+9)
+	binaryMsg = appendSchemaID(binaryMsg, s.WireFormat, s.SchemaID)
+	// avro serialized data in Avro’s binary encoding
+	return append(binaryMsg, binaryValue...), nil
+}
+
+// AvroDeserializer decodes values with the avro schemas fetched from the schema registry
+type AvroDeserializer struct {
+	API        avro.API
+	Client     SchemaRegistryClient
+	WireFormat WireFormat
+}
+
+// NewAvroDeserializer returns a deserializer fetching schemas with the schema registry client
+func NewAvroDeserializer(srClient SchemaRegistryClient) *AvroDeserializer {
+	return &AvroDeserializer{API: avro.DefaultConfig, Client: srClient}
+}
+
+func (d *AvroDeserializer) Deserialize(data []byte, v interface{}) error {
+	return d.DeserializeContext(context.Background(), data, v)
+}
+
+// DeserializeContext is Deserialize fetching the schema with the context when the schema registry client supports it
+func (d *AvroDeserializer) DeserializeContext(ctx context.Context, data []byte, v interface{}) error {
+	schemaID, payload, err := readSchemaID(data, d.WireFormat)
+	if err != nil {
+		return err
+	}
+	var schema avro.Schema
+	if getter, ok := d.Client.(contextSchemaGetter); ok {
+		schema, err = getter.GetSchemaByIDContext(ctx, schemaID)
+	} else {
+		schema, err = d.Client.GetSchemaByID(schemaID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return d.API.Unmarshal(schema, payload, v)
+}
@@ -0,0 +1,86 @@
+package kafkaavro_test
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvroSerializer_RoundTrip(t *testing.T) {
+	srClient := &mockSchemaRegistryClient{}
+
+	s, err := kafkaavro.NewAvroSerializer(srClient, "subject", avro.MustParse(`"string"`))
+	require.NoError(t, err)
+
+	data, err := s.Serialize("hello")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 1}, data[:5])
+
+	var out string
+	require.NoError(t, kafkaavro.NewAvroDeserializer(srClient).Deserialize(data, &out))
+	assert.Equal(t, "hello", out)
+
+	require.Error(t, kafkaavro.NewAvroDeserializer(srClient).Deserialize([]byte{0, 0}, &out))
+}
+
+func TestProducer_WithSerializers(t *testing.T) {
+	kp := &mockKafkaProducer{}
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		"",
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithKeySerializer(rawSerializer{}),
+		kafkaavro.WithValueSerializer(rawSerializer{}),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", "value", nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte("key"), msg.Key)
+	assert.Equal(t, []byte("value"), msg.Value)
+}
+
+func TestConsumer_WithDeserializer(t *testing.T) {
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithDeserializer(rawSerializer{}),
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	kc.On("Poll", 100).Return(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          []byte("value"),
+	})
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Equal(t, "value", msg.Value)
+}
+
+// rawSerializer passes strings through unchanged
+type rawSerializer struct{}
+
+func (rawSerializer) Serialize(value interface{}) ([]byte, error) {
+	return []byte(value.(string)), nil
+}
+
+func (rawSerializer) Deserialize(data []byte, v interface{}) error {
+	*(v.(*interface{})) = string(data)
+	return nil
+}
@@ -0,0 +1,117 @@
+package kafkaavro
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/hamba/avro"
+	"github.com/hamba/avro/pkg/crc64"
+)
+
+// singleObjectMagic is the two byte marker of the avro single object encoding
+var singleObjectMagic = []byte{0xC3, 0x01}
+
+// SchemaFingerprint returns the CRC-64-AVRO fingerprint of the schema Parsing Canonical Form
+func SchemaFingerprint(schema avro.Schema) uint64 {
+	h := crc64.New()
+	_, _ = h.Write([]byte(canonicalForm(schema)))
+	return h.Sum64()
+}
+
+// canonicalForm returns the Parsing Canonical Form of the schema. The canonical form of hamba schemas
+// already uses full names and drops docs, aliases and defaults, but keeps logical types and their
+// attributes, which the specification strips too.
+func canonicalForm(schema avro.Schema) string {
+	switch s := schema.(type) {
+	case *avro.PrimitiveSchema:
+		return `"` + string(s.Type()) + `"`
+	case *avro.FixedSchema:
+		return `{"name":"` + s.FullName() + `","type":"fixed","size":` + strconv.Itoa(s.Size()) + `}`
+	case *avro.RecordSchema:
+		typ := "record"
+		if s.IsError() {
+			typ = "error"
+		}
+		fields := make([]string, 0, len(s.Fields()))
+		for _, f := range s.Fields() {
+			fields = append(fields, `{"name":"`+f.Name()+`","type":`+canonicalForm(f.Type())+`}`)
+		}
+		return `{"name":"` + s.FullName() + `","type":"` + typ + `","fields":[` + strings.Join(fields, ",") + `]}`
+	case *avro.ArraySchema:
+		return `{"type":"array","items":` + canonicalForm(s.Items()) + `}`
+	case *avro.MapSchema:
+		return `{"type":"map","values":` + canonicalForm(s.Values()) + `}`
+	case *avro.UnionSchema:
+		types := make([]string, 0, len(s.Types()))
+		for _, typ := range s.Types() {
+			types = append(types, canonicalForm(typ))
+		}
+		return `[` + strings.Join(types, ",") + `]`
+	default:
+		// null, enum and reference schemas have no logical type
+		return schema.String()
+	}
+}
+
+// SingleObjectSerializer encodes values using the avro single object encoding:
+// 0xC3 0x01 marker, 8-byte little-endian CRC-64-AVRO schema fingerprint and the avro data.
+// It does not need a schema registry.
+type SingleObjectSerializer struct {
+	API    avro.API
+	Schema avro.Schema
+
+	fingerprint uint64
+}
+
+// NewSingleObjectSerializer returns a single object serializer encoding with the schema
+func NewSingleObjectSerializer(schema avro.Schema) *SingleObjectSerializer {
+	return &SingleObjectSerializer{API: avro.DefaultConfig, Schema: schema, fingerprint: SchemaFingerprint(schema)}
+}
+
+func (s *SingleObjectSerializer) Serialize(value interface{}) ([]byte, error) {
+	binaryValue, err := s.API.Marshal(s.Schema, value)
+	if err != nil {
+		return nil, err
+	}
+
+	binaryMsg := make([]byte, 10, len(binaryValue)+10)
+	copy(binaryMsg, singleObjectMagic)
+	binary.LittleEndian.PutUint64(binaryMsg[2:], s.fingerprint)
+	return append(binaryMsg, binaryValue...), nil
+}
+
+// SingleObjectDeserializer decodes the avro single object encoding,
+// fingerprints are resolved against a locally provided set of schemas
+type SingleObjectDeserializer struct {
+	API avro.API
+
+	schemas map[uint64]avro.Schema
+}
+
+// NewSingleObjectDeserializer returns a single object deserializer resolving fingerprints against the schemas
+func NewSingleObjectDeserializer(schemas ...avro.Schema) *SingleObjectDeserializer {
+	d := &SingleObjectDeserializer{API: avro.DefaultConfig, schemas: make(map[uint64]avro.Schema, len(schemas))}
+	for _, schema := range schemas {
+		d.schemas[SchemaFingerprint(schema)] = schema
+	}
+	return d
+}
+
+func (d *SingleObjectDeserializer) Deserialize(data []byte, v interface{}) error {
+	if len(data) < 10 {
+		return ErrTruncatedPayload{Length: len(data), Expected: 10}
+	}
+	if data[0] != singleObjectMagic[0] {
+		return ErrInvalidMagicByte{MagicByte: data[0]}
+	}
+	if data[1] != singleObjectMagic[1] {
+		return ErrInvalidMagicByte{MagicByte: data[1]}
+	}
+	fingerprint := binary.LittleEndian.Uint64(data[2:10])
+	schema, ok := d.schemas[fingerprint]
+	if !ok {
+		return ErrSchemaNotFound{Fingerprint: fingerprint}
+	}
+	return d.API.Unmarshal(schema, data[10:], v)
+}
@@ -0,0 +1,128 @@
+package kafkaavro_test
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaFingerprint(t *testing.T) {
+	// test vectors from the avro specification test suite, written with attributes the canonical form strips
+	for schema, fingerprint := range map[string]uint64{
+		`"int"`: 8247732601305521295,
+		`{"type": "long", "logicalType": "timestamp-millis"}`:                                    15011871142588980663,
+		`{"type": "fixed", "name": "foo", "size": 15, "logicalType": "decimal", "precision": 4}`: 1756455273707447556,
+		`{"type": "record", "name": "foo", "doc": "a record", "aliases": ["bar"], "fields": [
+			{"name": "f1", "type": "boolean", "doc": "a field", "default": true}
+		]}`: 7843277075252814651,
+	} {
+		assert.Equal(t, fingerprint, kafkaavro.SchemaFingerprint(avro.MustParse(schema)), schema)
+	}
+
+	// logical types nested in records, arrays, maps and unions are stripped
+	logical := avro.MustParse(`{"type": "record", "name": "event", "namespace": "com.example", "fields": [
+		{"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "days", "type": {"type": "array", "items": {"type": "int", "logicalType": "date"}}},
+		{"name": "ids", "type": {"type": "map", "values": {"type": "string", "logicalType": "uuid"}}},
+		{"name": "amount", "type": ["null", {"type": "bytes", "logicalType": "decimal", "precision": 4, "scale": 2}]}
+	]}`)
+	plain := avro.MustParse(`{"type": "record", "name": "com.example.event", "fields": [
+		{"name": "at", "type": "long"},
+		{"name": "days", "type": {"type": "array", "items": "int"}},
+		{"name": "ids", "type": {"type": "map", "values": "string"}},
+		{"name": "amount", "type": ["null", "bytes"]}
+	]}`)
+	assert.Equal(t, kafkaavro.SchemaFingerprint(plain), kafkaavro.SchemaFingerprint(logical))
+	assert.NotEqual(t, logical.String(), plain.String())
+}
+
+func TestSingleObjectEncoding_RoundTrip(t *testing.T) {
+	kp := &mockKafkaProducer{}
+	// no expectations are set, any schema registry call fails the test
+	srClient := &mockSchemaLookupClient{}
+
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"int"`,
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithSingleObjectEncoding(),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", 1, nil))
+
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, []byte{0xC3, 0x01, 0x8f, 0x5c, 0x39, 0x3f, 0x1a, 0xd5, 0x75, 0x72, 2}, msg.Value)
+
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return 0
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithSingleObjectSchemas(avro.MustParse(`"string"`), avro.MustParse(`"int"`)),
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	kc.On("Poll", 100).Return(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          msg.Value,
+	})
+	consumed, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Equal(t, 1, consumed.Value)
+}
+
+func TestSingleObjectDeserializer_UnknownFingerprint(t *testing.T) {
+	data, err := kafkaavro.NewSingleObjectSerializer(avro.MustParse(`"long"`)).Serialize(int64(1))
+	require.NoError(t, err)
+
+	var out int64
+	d := kafkaavro.NewSingleObjectDeserializer(avro.MustParse(`"int"`))
+	assert.True(t, kafkaavro.IsErrSchemaNotFound(d.Deserialize(data, &out)))
+	assert.True(t, kafkaavro.IsErrTruncatedPayload(d.Deserialize([]byte{0, 0, 0, 0, 1, 2}, &out)))
+	assert.True(t, kafkaavro.IsErrInvalidMagicByte(d.Deserialize(make([]byte, 11), &out)))
+}
+
+type singleObjectUser struct {
+	Name string `json:"name"`
+}
+
+func TestSingleObjectDeserializer_AvroAPI(t *testing.T) {
+	schema := avro.MustParse(`{"type": "record", "name": "user", "fields": [{"name": "name", "type": "string"}]}`)
+	data, err := kafkaavro.NewSingleObjectSerializer(schema).Serialize(map[string]interface{}{"name": "jane"})
+	require.NoError(t, err)
+
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return &singleObjectUser{}
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaLookupClient{}),
+		kafkaavro.WithSingleObjectSchemas(schema),
+		kafkaavro.WithAvroAPI(avro.Config{TagKey: "json"}.Freeze()),
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	kc.On("Poll", 100).Return(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          data,
+	})
+	consumed, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.Equal(t, &singleObjectUser{Name: "jane"}, consumed.Value)
+}
@@ -0,0 +1,186 @@
+package kafkaavro
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Stats are the statistics emitted by librdkafka every statistics.interval.ms,
+// see https://github.com/edenhill/librdkafka/blob/master/STATISTICS.md for the meaning of every field
+type Stats struct {
+	Name     string `json:"name"`
+	ClientID string `json:"client_id"`
+	// Type is either producer or consumer
+	Type string `json:"type"`
+	// Ts is the librdkafka monotonic clock in microseconds
+	Ts int64 `json:"ts"`
+	// Time is the wall clock time in seconds since the epoch
+	Time int64 `json:"time"`
+	// Age is the time since the client instance was created in microseconds
+	Age int64 `json:"age"`
+	// ReplyQ is the number of events waiting to be served, such as delivery reports
+	ReplyQ int64 `json:"replyq"`
+	// MsgCnt and MsgSize are the number and size of messages in the producer queues
+	MsgCnt     int64 `json:"msg_cnt"`
+	MsgSize    int64 `json:"msg_size"`
+	MsgMax     int64 `json:"msg_max"`
+	MsgSizeMax int64 `json:"msg_size_max"`
+
+	Tx         int64 `json:"tx"`
+	TxBytes    int64 `json:"tx_bytes"`
+	Rx         int64 `json:"rx"`
+	RxBytes    int64 `json:"rx_bytes"`
+	TxMsgs     int64 `json:"txmsgs"`
+	TxMsgBytes int64 `json:"txmsg_bytes"`
+	RxMsgs     int64 `json:"rxmsgs"`
+	RxMsgBytes int64 `json:"rxmsg_bytes"`
+
+	// Brokers are keyed by broker name
+	Brokers map[string]BrokerStats `json:"brokers"`
+	// Topics are keyed by topic name
+	Topics map[string]TopicStats `json:"topics"`
+	// ConsumerGroup is only set for consumers
+	ConsumerGroup *ConsumerGroupStats `json:"cgrp"`
+}
+
+// BrokerStats are the statistics of a broker connection
+type BrokerStats struct {
+	Name     string `json:"name"`
+	NodeID   int32  `json:"nodeid"`
+	NodeName string `json:"nodename"`
+	Source   string `json:"source"`
+	// State is the connection state, such as UP or DOWN
+	State    string `json:"state"`
+	StateAge int64  `json:"stateage"`
+
+	// OutbufCnt and OutbufMsgCnt are the number of requests and messages waiting to be sent
+	OutbufCnt    int64 `json:"outbuf_cnt"`
+	OutbufMsgCnt int64 `json:"outbuf_msg_cnt"`
+	// WaitrespCnt and WaitrespMsgCnt are the number of requests and messages in flight
+	WaitrespCnt    int64 `json:"waitresp_cnt"`
+	WaitrespMsgCnt int64 `json:"waitresp_msg_cnt"`
+
+	Tx          int64 `json:"tx"`
+	TxBytes     int64 `json:"txbytes"`
+	TxErrs      int64 `json:"txerrs"`
+	TxRetries   int64 `json:"txretries"`
+	ReqTimeouts int64 `json:"req_timeouts"`
+	Rx          int64 `json:"rx"`
+	RxBytes     int64 `json:"rxbytes"`
+	RxErrs      int64 `json:"rxerrs"`
+	Connects    int64 `json:"connects"`
+	Disconnects int64 `json:"disconnects"`
+
+	// IntLatency is the time messages spend in the producer queue in microseconds
+	IntLatency WindowStats `json:"int_latency"`
+	// OutbufLatency is the time requests spend waiting to be sent in microseconds
+	OutbufLatency WindowStats `json:"outbuf_latency"`
+	// Rtt is the broker round trip time in microseconds
+	Rtt WindowStats `json:"rtt"`
+	// Throttle is the broker throttling time in milliseconds
+	Throttle WindowStats `json:"throttle"`
+}
+
+// WindowStats summarize the values observed during the last statistics interval
+type WindowStats struct {
+	Min    int64   `json:"min"`
+	Max    int64   `json:"max"`
+	Avg    int64   `json:"avg"`
+	Sum    int64   `json:"sum"`
+	Cnt    int64   `json:"cnt"`
+	StdDev float64 `json:"stddev"`
+	P50    int64   `json:"p50"`
+	P75    int64   `json:"p75"`
+	P90    int64   `json:"p90"`
+	P95    int64   `json:"p95"`
+	P99    int64   `json:"p99"`
+	P9999  int64   `json:"p99_99"`
+}
+
+// TopicStats are the statistics of a topic
+type TopicStats struct {
+	Topic       string `json:"topic"`
+	Age         int64  `json:"age"`
+	MetadataAge int64  `json:"metadata_age"`
+	// BatchSize and BatchCnt are the size in bytes and the number of messages of produced batches
+	BatchSize WindowStats `json:"batchsize"`
+	BatchCnt  WindowStats `json:"batchcnt"`
+	// Partitions are keyed by partition number, -1 being the internal unassigned partition
+	Partitions map[string]PartitionStats `json:"partitions"`
+}
+
+// PartitionStats are the statistics of a topic partition
+type PartitionStats struct {
+	Partition int32 `json:"partition"`
+	Broker    int32 `json:"broker"`
+	Leader    int32 `json:"leader"`
+	Desired   bool  `json:"desired"`
+	Unknown   bool  `json:"unknown"`
+
+	// MsgqCnt and MsgqBytes are the messages waiting in the partition queue
+	MsgqCnt   int64 `json:"msgq_cnt"`
+	MsgqBytes int64 `json:"msgq_bytes"`
+	// XmitMsgqCnt and XmitMsgqBytes are the messages ready to be sent
+	XmitMsgqCnt   int64 `json:"xmit_msgq_cnt"`
+	XmitMsgqBytes int64 `json:"xmit_msgq_bytes"`
+	// FetchqCnt and FetchqSize are the pre-fetched messages waiting to be consumed
+	FetchqCnt  int64  `json:"fetchq_cnt"`
+	FetchqSize int64  `json:"fetchq_size"`
+	FetchState string `json:"fetch_state"`
+
+	QueryOffset     int64 `json:"query_offset"`
+	NextOffset      int64 `json:"next_offset"`
+	AppOffset       int64 `json:"app_offset"`
+	StoredOffset    int64 `json:"stored_offset"`
+	CommittedOffset int64 `json:"committed_offset"`
+	EOFOffset       int64 `json:"eof_offset"`
+	LoOffset        int64 `json:"lo_offset"`
+	HiOffset        int64 `json:"hi_offset"`
+	LsOffset        int64 `json:"ls_offset"`
+	// ConsumerLag is the difference between the high watermark and the committed offset, -1 when unknown
+	ConsumerLag int64 `json:"consumer_lag"`
+	// ConsumerLagStored is the difference between the high watermark and the stored offset, -1 when unknown
+	ConsumerLagStored int64 `json:"consumer_lag_stored"`
+
+	TxMsgs       int64 `json:"txmsgs"`
+	TxBytes      int64 `json:"txbytes"`
+	RxMsgs       int64 `json:"rxmsgs"`
+	RxBytes      int64 `json:"rxbytes"`
+	Msgs         int64 `json:"msgs"`
+	RxVerDrops   int64 `json:"rx_ver_drops"`
+	MsgsInflight int64 `json:"msgs_inflight"`
+}
+
+// ConsumerGroupStats are the statistics of the consumer group membership
+type ConsumerGroupStats struct {
+	State           string `json:"state"`
+	StateAge        int64  `json:"stateage"`
+	JoinState       string `json:"join_state"`
+	RebalanceAge    int64  `json:"rebalance_age"`
+	RebalanceCnt    int64  `json:"rebalance_cnt"`
+	RebalanceReason string `json:"rebalance_reason"`
+	AssignmentSize  int64  `json:"assignment_size"`
+}
+
+// StatsHandler receives the statistics parsed from the statistics events of the kafka client
+type StatsHandler func(stats *Stats)
+
+// ParseStats parses the statistics JSON emitted by librdkafka
+func ParseStats(statsJSON string) (*Stats, error) {
+	stats := &Stats{}
+	if err := json.Unmarshal([]byte(statsJSON), stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// handleStats parses the statistics event and passes it to the handler, unparsable statistics are logged
+func handleStats(handler StatsHandler, logger Logger, event *kafka.Stats) {
+	stats, err := ParseStats(event.String())
+	if err != nil {
+		logger.Warn("cannot parse kafka statistics", "error", err)
+		return
+	}
+	handler(stats)
+}
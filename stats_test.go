@@ -0,0 +1,129 @@
+package kafkaavro_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const statsJSON = `{
+  "name": "rdkafka#consumer-1", "client_id": "rdkafka", "type": "consumer",
+  "ts": 5016483227792, "time": 1527060869, "replyq": 0, "msg_cnt": 0,
+  "brokers": {
+    "localhost:9092/0": {
+      "name": "localhost:9092/0", "nodeid": 0, "state": "UP", "outbuf_cnt": 2,
+      "rtt": {"min": 100, "max": 300, "avg": 200, "p99": 290}
+    }
+  },
+  "topics": {
+    "users": {
+      "topic": "users",
+      "partitions": {
+        "0": {"partition": 0, "leader": 0, "fetchq_cnt": 12, "committed_offset": 90, "hi_offset": 100, "consumer_lag": 10},
+        "-1": {"partition": -1, "leader": -1, "consumer_lag": -1}
+      }
+    }
+  },
+  "cgrp": {"state": "up", "join_state": "steady", "rebalance_cnt": 1, "assignment_size": 1}
+}`
+
+func TestParseStats(t *testing.T) {
+	stats, err := kafkaavro.ParseStats(statsJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, "consumer", stats.Type)
+	assert.Equal(t, "UP", stats.Brokers["localhost:9092/0"].State)
+	assert.Equal(t, int64(2), stats.Brokers["localhost:9092/0"].OutbufCnt)
+	assert.Equal(t, int64(290), stats.Brokers["localhost:9092/0"].Rtt.P99)
+
+	partition := stats.Topics["users"].Partitions["0"]
+	assert.Equal(t, int64(12), partition.FetchqCnt)
+	assert.Equal(t, int64(10), partition.ConsumerLag)
+	assert.Equal(t, int64(-1), stats.Topics["users"].Partitions["-1"].ConsumerLag)
+
+	require.NotNil(t, stats.ConsumerGroup)
+	assert.Equal(t, "steady", stats.ConsumerGroup.JoinState)
+	assert.Equal(t, int64(1), stats.ConsumerGroup.AssignmentSize)
+
+	_, err = kafkaavro.ParseStats("{")
+	assert.Error(t, err)
+}
+
+// unreachableKafkaConfig configures a kafka client emitting statistics without any broker to connect to
+func unreachableKafkaConfig() *kafka.ConfigMap {
+	return &kafka.ConfigMap{
+		"bootstrap.servers":      "127.0.0.1:1",
+		"group.id":               "group",
+		"statistics.interval.ms": 10,
+	}
+}
+
+func TestProducer_StatsHandler(t *testing.T) {
+	received := make(chan *kafkaavro.Stats, 1)
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaConfig(unreachableKafkaConfig()),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithLogger(kafkaavro.NopLogger()),
+		kafkaavro.WithStatsHandler(func(stats *kafkaavro.Stats) {
+			select {
+			case received <- stats:
+			default:
+			}
+		}),
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	select {
+	case stats := <-received:
+		assert.Equal(t, "producer", stats.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no statistics received")
+	}
+}
+
+func TestProducer_StatsHandlerWithoutEvents(t *testing.T) {
+	_, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(&mockKafkaProducer{}),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithStatsHandler(func(stats *kafkaavro.Stats) {}),
+	)
+	assert.EqualError(t, err, "kafka producer does not report statistics")
+}
+
+func TestConsumer_StatsHandler(t *testing.T) {
+	var received *kafkaavro.Stats
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConfig(unreachableKafkaConfig()),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+		kafkaavro.WithLogger(kafkaavro.NopLogger()),
+		kafkaavro.WithStatsHandler(func(stats *kafkaavro.Stats) {
+			received = stats
+		}),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for received == nil && time.Now().Before(deadline) {
+		_, err := c.FetchMessage(10)
+		require.NoError(t, err)
+	}
+	require.NotNil(t, received)
+	assert.Equal(t, "consumer", received.Type)
+}
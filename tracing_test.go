@@ -0,0 +1,133 @@
+package kafkaavro_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/hamba/avro"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/mycujoo/go-kafka-avro/v2/kafkaavrotest"
+	"github.com/mycujoo/go-kafka-avro/v2/registryserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	server := httptest.NewServer(registryserver.New())
+	defer server.Close()
+	srURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	broker := kafkaavrotest.NewBroker()
+
+	p, err := kafkaavro.NewProducer(
+		"users",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryURL(srURL),
+		kafkaavro.WithTracerProvider(tp),
+	)
+	require.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	require.NoError(t, p.ProduceContext(ctx, "jane", "jane", nil))
+	parent.End()
+
+	headers := broker.Messages("users")[0].Headers
+	require.Len(t, headers, 1)
+	assert.Equal(t, "traceparent", headers[0].Key)
+
+	c, err := kafkaavro.NewConsumer(
+		[]string{"users"},
+		func(topic string) interface{} {
+			return ""
+		},
+		kafkaavro.WithKafkaConsumer(broker.NewKafkaConsumer("group")),
+		kafkaavro.WithSchemaRegistryURL(srURL),
+		kafkaavro.WithTracerProvider(tp),
+	)
+	require.NoError(t, err)
+	msg, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	assert.Equal(t, "jane", msg.Value)
+
+	consumerSpan := trace.SpanFromContext(msg.Context()).SpanContext()
+	assert.Equal(t, parent.SpanContext().TraceID(), consumerSpan.TraceID())
+	require.NoError(t, c.Close())
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, "users send")
+	require.Contains(t, spans, "users process")
+	assert.Equal(t, trace.SpanKindProducer, spans["users send"].SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans["users send"].Parent().SpanID())
+	assert.Equal(t, trace.SpanKindConsumer, spans["users process"].SpanKind())
+	assert.Equal(t, spans["users send"].SpanContext().SpanID(), spans["users process"].Parent().SpanID())
+
+	// the schema is fetched within the consumer span
+	var fetched bool
+	for _, span := range recorder.Ended() {
+		if span.Name() == "HTTP GET" && span.Parent().SpanID() == consumerSpan.SpanID() {
+			fetched = true
+		}
+	}
+	assert.True(t, fetched)
+}
+
+func TestTracing_RegistryHTTPClient(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	server := httptest.NewTLSServer(registryserver.New())
+	defer server.Close()
+
+	// the client of the TLS server trusts its certificate, requests sent with another client fail
+	srClient, err := kafkaavro.NewCachedSchemaRegistryClientWithOptions(server.URL,
+		kafkaavro.WithRegistryHTTPClient(server.Client()),
+		kafkaavro.WithRegistryTracerProvider(tp),
+	)
+	require.NoError(t, err)
+	id, err := srClient.RegisterNewSchema("users-value", avro.MustParse(`"string"`))
+	require.NoError(t, err)
+	_, err = srClient.GetSchemaByID(id)
+	require.NoError(t, err)
+
+	var methods []string
+	for _, span := range recorder.Ended() {
+		methods = append(methods, span.Name())
+	}
+	assert.Equal(t, []string{"HTTP POST", "HTTP GET"}, methods)
+}
+
+func TestTracing_Disabled(t *testing.T) {
+	broker := kafkaavrotest.NewBroker()
+	p, err := kafkaavro.NewProducer(
+		"users",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(broker.NewKafkaProducer()),
+		kafkaavro.WithSchemaRegistryClient(kafkaavrotest.NewSchemaRegistryClient()),
+	)
+	require.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	require.NoError(t, p.ProduceContext(ctx, "jane", "jane", nil))
+
+	var headers []kafka.Header
+	for _, msg := range broker.Messages("users") {
+		headers = append(headers, msg.Headers...)
+	}
+	assert.Empty(t, headers)
+}
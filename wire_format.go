@@ -0,0 +1,105 @@
+package kafkaavro
+
+import (
+	"encoding/binary"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// WireFormat describes how the schema ID is carried along the encoded data
+type WireFormat int
+
+const (
+	// WireFormatAuto writes the Confluent wire format and detects the wire format when reading
+	WireFormatAuto WireFormat = iota
+	// WireFormatConfluent prefixes data with a 0 magic byte and a 4-byte schema ID
+	WireFormatConfluent
+	// WireFormatApicurio prefixes data with a 0 magic byte and an 8-byte global ID
+	WireFormatApicurio
+	// WireFormatApicurioHeaders carries the 8-byte global ID in the apicurio.key.globalId
+	// and apicurio.value.globalId message headers, data is not prefixed
+	WireFormatApicurioHeaders
+)
+
+// Apicurio message headers carrying global IDs
+const (
+	ApicurioKeyGlobalIDHeader   = "apicurio.key.globalId"
+	ApicurioValueGlobalIDHeader = "apicurio.value.globalId"
+)
+
+// prefixFormat returns the format used by serializers and deserializers, which only deal with
+// prefixed data. Producers and consumers move IDs between headers and the prefix.
+func (f WireFormat) prefixFormat() WireFormat {
+	if f == WireFormatApicurioHeaders {
+		return WireFormatApicurio
+	}
+	return f
+}
+
+// appendSchemaID writes the magic byte and the schema ID
+func appendSchemaID(buf []byte, format WireFormat, schemaID int) []byte {
+	// first byte is magic byte, always 0 for now
+	buf = append(buf, byte(0))
+	if format.prefixFormat() == WireFormatApicurio {
+		binarySchemaId := make([]byte, 8)
+		binary.BigEndian.PutUint64(binarySchemaId, uint64(schemaID))
+		return append(buf, binarySchemaId...)
+	}
+	// 4-byte schema ID as returned by the Schema Registry
+	binarySchemaId := make([]byte, 4)
+	binary.BigEndian.PutUint32(binarySchemaId, uint32(schemaID))
+	return append(buf, binarySchemaId...)
+}
+
+// readSchemaID reads the magic byte and schema ID and returns the remaining payload.
+// In auto mode an ID whose first 4 bytes are 0 is read as an 8-byte ID,
+// the schema registry never assigns the 4-byte ID 0.
+func readSchemaID(data []byte, format WireFormat) (int, []byte, error) {
+	if len(data) < 5 {
+		return 0, nil, ErrTruncatedPayload{Length: len(data), Expected: 5}
+	}
+	if data[0] != 0 {
+		return 0, nil, ErrInvalidMagicByte{MagicByte: data[0]}
+	}
+	format = format.prefixFormat()
+	if format == WireFormatAuto && len(data) >= 9 && binary.BigEndian.Uint32(data[1:5]) == 0 {
+		format = WireFormatApicurio
+	}
+	if format == WireFormatApicurio {
+		if len(data) < 9 {
+			return 0, nil, ErrTruncatedPayload{Length: len(data), Expected: 9}
+		}
+		return int(binary.BigEndian.Uint64(data[1:9])), data[9:], nil
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// moveSchemaIDToHeader strips the 8-byte schema ID prefix written for headers and returns it as an Apicurio header
+func moveSchemaIDToHeader(data []byte, headerKey string) ([]byte, kafka.Header, error) {
+	schemaID, payload, err := readSchemaID(data, WireFormatApicurio)
+	if err != nil {
+		return nil, kafka.Header{}, err
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(schemaID))
+	return payload, kafka.Header{Key: headerKey, Value: value}, nil
+}
+
+// moveSchemaIDFromHeader prefixes data with the schema ID carried by the Apicurio header,
+// it reports false when the header is not present
+func moveSchemaIDFromHeader(data []byte, headers []kafka.Header, headerKey string) ([]byte, bool, error) {
+	for _, header := range headers {
+		if header.Key != headerKey {
+			continue
+		}
+		if len(header.Value) != 8 {
+			return nil, false, errors.Errorf("invalid %s header", headerKey)
+		}
+		prefixed := make([]byte, 0, len(data)+9)
+		prefixed = append(prefixed, byte(0))
+		prefixed = append(prefixed, header.Value...)
+		return append(prefixed, data...), true, nil
+	}
+	return data, false, nil
+}
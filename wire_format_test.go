@@ -0,0 +1,157 @@
+package kafkaavro_test
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	kafkaavro "github.com/mycujoo/go-kafka-avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func produceWithWireFormat(t *testing.T, format kafkaavro.WireFormat) *kafka.Message {
+	kp := &mockKafkaProducer{}
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		`"string"`,
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		kafkaavro.WithWireFormat(format),
+	)
+	require.NoError(t, err)
+
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	require.NoError(t, p.Produce("key", "hi", nil))
+	return kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+}
+
+func consumeWithWireFormat(t *testing.T, msg *kafka.Message, opts ...kafkaavro.ConsumerOption) (*kafkaavro.Message, error) {
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return ""
+		},
+		append([]kafkaavro.ConsumerOption{
+			kafkaavro.WithKafkaConsumer(kc),
+			kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+		}, opts...)...,
+	)
+	require.NoError(t, err)
+
+	topic := "topic"
+	msg.TopicPartition.Topic = &topic
+	kc.On("Poll", 100).Return(msg)
+	return c.FetchMessage(100)
+}
+
+func TestWireFormat_Apicurio(t *testing.T) {
+	msg := produceWithWireFormat(t, kafkaavro.WireFormatApicurio)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 1, 4, 'h', 'i'}, msg.Value)
+	assert.Empty(t, msg.Headers)
+
+	consumed, err := consumeWithWireFormat(t, msg)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", consumed.Value)
+
+	consumed, err = consumeWithWireFormat(t, msg, kafkaavro.WithWireFormat(kafkaavro.WireFormatApicurio))
+	require.NoError(t, err)
+	assert.Equal(t, "hi", consumed.Value)
+}
+
+func TestWireFormat_ApicurioHeaders(t *testing.T) {
+	msg := produceWithWireFormat(t, kafkaavro.WireFormatApicurioHeaders)
+	assert.Equal(t, []byte{4, 'h', 'i'}, msg.Value)
+	assert.Equal(t, []kafka.Header{
+		{Key: kafkaavro.ApicurioKeyGlobalIDHeader, Value: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{Key: kafkaavro.ApicurioValueGlobalIDHeader, Value: []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+	}, msg.Headers)
+
+	consumed, err := consumeWithWireFormat(t, msg)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", consumed.Value)
+
+	_, err = consumeWithWireFormat(t, &kafka.Message{Value: msg.Value}, kafkaavro.WithWireFormat(kafkaavro.WireFormatApicurioHeaders))
+	require.Error(t, err)
+}
+
+func TestWireFormat_ApicurioHeadersUnsupported(t *testing.T) {
+	for name, opt := range map[string]kafkaavro.ProducerOption{
+		"single object encoding": kafkaavro.WithSingleObjectEncoding(),
+		"key serializer":         kafkaavro.WithKeySerializer(&kafkaavro.AvroSerializer{}),
+		"value serializer":       kafkaavro.WithValueSerializer(&kafkaavro.AvroSerializer{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := kafkaavro.NewProducer(
+				"topic",
+				`"string"`,
+				`"string"`,
+				kafkaavro.WithKafkaProducer(&mockKafkaProducer{}),
+				kafkaavro.WithSchemaRegistryClient(&mockSchemaRegistryClient{}),
+				kafkaavro.WithWireFormat(kafkaavro.WireFormatApicurioHeaders),
+				opt,
+			)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "schema IDs in headers")
+		})
+	}
+}
+
+func TestWireFormat_Confluent(t *testing.T) {
+	msg := produceWithWireFormat(t, kafkaavro.WireFormatAuto)
+	assert.Equal(t, []byte{0, 0, 0, 0, 1, 4, 'h', 'i'}, msg.Value)
+
+	consumed, err := consumeWithWireFormat(t, msg, kafkaavro.WithWireFormat(kafkaavro.WireFormatConfluent))
+	require.NoError(t, err)
+	assert.Equal(t, "hi", consumed.Value)
+}
+
+func TestWireFormat_ApicurioLargeSchemaID(t *testing.T) {
+	const schemaID = 1 << 32
+	kp := &mockKafkaProducer{}
+	srClient := &mockSchemaOfTypeClient{}
+	srClient.On("RegisterNewSchemaOfType", "topic-value", kafkaavro.SchemaTypeProtobuf, timestampProto, []kafkaavro.SchemaReference(nil)).Return(schemaID, nil)
+	p, err := kafkaavro.NewProducer(
+		"topic",
+		`"string"`,
+		"",
+		kafkaavro.WithKafkaProducer(kp),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithProtobufValueSchema(timestampProto),
+		kafkaavro.WithWireFormat(kafkaavro.WireFormatApicurioHeaders),
+	)
+	require.NoError(t, err)
+	kp.On("Produce", mock.AnythingOfType("*kafka.Message"), mock.Anything).Return(nil)
+	ts := &timestamppb.Timestamp{Seconds: 1600000000}
+	require.NoError(t, p.Produce("key", ts, nil))
+	msg := kp.Calls[0].Arguments.Get(0).(*kafka.Message)
+	assert.Equal(t, kafka.Header{Key: kafkaavro.ApicurioValueGlobalIDHeader, Value: []byte{0, 0, 0, 1, 0, 0, 0, 0}}, msg.Headers[1])
+
+	// the consumer wire format applies to the protobuf deserializer, the ID prefix is not guessed
+	payload, err := proto.Marshal(ts)
+	require.NoError(t, err)
+	kc := &mockKafkaConsumer{}
+	c, err := kafkaavro.NewConsumer(
+		nil,
+		func(topic string) interface{} {
+			return &timestamppb.Timestamp{}
+		},
+		kafkaavro.WithKafkaConsumer(kc),
+		kafkaavro.WithSchemaRegistryClient(srClient),
+		kafkaavro.WithProtobufDeserializer(),
+		kafkaavro.WithWireFormat(kafkaavro.WireFormatApicurio),
+	)
+	require.NoError(t, err)
+	topic := "topic"
+	kc.On("Poll", 100).Return(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          append([]byte{0, 0, 0, 0, 1, 0, 0, 0, 0, 0}, payload...),
+	})
+	consumed, err := c.FetchMessage(100)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(ts, consumed.Value.(*timestamppb.Timestamp)))
+}